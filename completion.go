@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The commands which list the values of flags for dynamic completion, keyed by flag name.
+// Each outputs one value per line, followed by a tab and details which are not part of the value.
+var completionValueCommands = map[string]string{
+	"job":  programName + " --list-jobs",
+	"test": programName + " --list-tests --echo-config=false",
+}
+
+// Writes a script for the given shell, one of bash, zsh, or fish, which completes the subcommands and flags of the command.
+// The values of --job and --test are completed using --list-jobs and --list-tests.
+func writeCompletionScript(w io.Writer, shell string) error {
+	flags := newFlagSet(&config{})
+	switch shell {
+	case "bash":
+		return writeBashCompletion(w, flags)
+	case "zsh":
+		return writeZshCompletion(w, flags)
+	case "fish":
+		return writeFishCompletion(w, flags)
+	default:
+		return usageError{err: errors.New("completion shell must be one of bash, zsh, or fish. see usage via --help")}
+	}
+}
+
+// Returns the names of the subcommands.
+func subcommandNames() []string {
+	names := []string{}
+	for _, command := range subcommands {
+		names = append(names, command.name)
+	}
+	return names
+}
+
+// Returns the first sentence of the description of the given subcommand, which is short enough to show beside each completion.
+func shortDescription(command subcommand) string {
+	description, _, _ := strings.Cut(command.description, ". ")
+	return strings.TrimSuffix(description, ".")
+}
+
+// Returns whether the given flag takes no value, like a bool flag.
+func isBoolFlag(f *flag.Flag) bool {
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// Returns the first sentence of the usage of the given flag, which is short enough to show beside each completion.
+func shortUsage(f *flag.Flag) string {
+	usage, _, _ := strings.Cut(f.Usage, ". ")
+	return strings.TrimSuffix(usage, ".")
+}
+
+func writeBashCompletion(w io.Writer, flags *flag.FlagSet) error {
+	names := []string{}
+	flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, "--"+f.Name)
+	})
+
+	cases := ""
+	for _, name := range []string{"job", "test"} {
+		// the words before the flag, after any subcommand, are passed along so that the values are listed for the same run
+		cases += fmt.Sprintf(`	--%[1]s|-%[1]s)
+		COMPREPLY=($(compgen -W "$(%[2]s "${COMP_WORDS[@]:first:COMP_CWORD-first-1}" 2>/dev/null | cut -f1)" -- "$cur"))
+		return
+		;;
+`, name, completionValueCommands[name])
+	}
+
+	_, err := fmt.Fprintf(w, `_%[1]s() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local prev="${COMP_WORDS[COMP_CWORD-1]}"
+	local IFS=$'\n'
+	local first=1
+	case "${COMP_WORDS[1]}" in
+	%[4]s)
+		first=2
+		;;
+	esac
+	case "$prev" in
+%[2]s	esac
+	if [[ $COMP_CWORD -eq 1 ]]; then
+		COMPREPLY=($(compgen -W "%[5]s
+%[3]s" -- "$cur"))
+		return
+	fi
+	COMPREPLY=($(compgen -W "%[3]s" -- "$cur"))
+}
+complete -o default -F _%[1]s %[1]s
+`, programName, cases, strings.Join(names, "\n"), strings.Join(subcommandNames(), "|"), strings.Join(subcommandNames(), "\n"))
+	return err
+}
+
+func writeZshCompletion(w io.Writer, flags *flag.FlagSet) error {
+	escape := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`)
+	specs := []string{}
+	flags.VisitAll(func(f *flag.Flag) {
+		spec := fmt.Sprintf("'--%s[%s]", f.Name, escape.Replace(shortUsage(f)))
+		if _, ok := completionValueCommands[f.Name]; ok {
+			spec += fmt.Sprintf(":%s:_%s_%s", f.Name, programName, f.Name)
+		} else if !isBoolFlag(f) {
+			spec += fmt.Sprintf(":%s: ", f.Name)
+		}
+		specs = append(specs, spec+"'")
+	})
+
+	commands := []string{}
+	for _, command := range subcommands {
+		commands = append(commands, fmt.Sprintf(`%s\:"%s"`, command.name, escape.Replace(strings.ReplaceAll(shortDescription(command), `"`, `\"`))))
+	}
+	// the subcommand comes before the flags, and filter reads the file which follows them
+	specs = append(specs, fmt.Sprintf("'1:subcommand:((%s))'", strings.Join(commands, " ")), "'*:file:_files'")
+
+	functions := ""
+	for _, name := range []string{"job", "test"} {
+		// the words before the flag, after any subcommand, are passed along so that the values are listed for the same run
+		functions += fmt.Sprintf(`_%[1]s_%[2]s() {
+	local -a values args
+	args=(${words[2,CURRENT-2]})
+	if [[ ${args[1]} == (%[4]s) ]]; then
+		shift args
+	fi
+	values=(${(f)"$(%[3]s ${args} 2>/dev/null | cut -f1)"})
+	compadd -a values
+}
+
+`, programName, name, completionValueCommands[name], strings.Join(subcommandNames(), "|"))
+	}
+
+	_, err := fmt.Fprintf(w, `#compdef %[1]s
+
+%[2]s_arguments \
+	%[3]s
+`, programName, functions, strings.Join(specs, " \\\n\t"))
+	return err
+}
+
+func writeFishCompletion(w io.Writer, flags *flag.FlagSet) error {
+	escape := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+	for _, command := range subcommands {
+		line := fmt.Sprintf("complete -c %s -n __fish_use_subcommand -f -a %s -d '%s'", programName, command.name, escape.Replace(shortDescription(command)))
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		line := fmt.Sprintf("complete -c %s -l %s -d '%s'", programName, f.Name, escape.Replace(shortUsage(f)))
+		if command, ok := completionValueCommands[f.Name]; ok {
+			line += fmt.Sprintf(" -x -a '(%s 2>/dev/null | cut -f1)'", command)
+		} else if !isBoolFlag(f) {
+			line += " -r"
+		}
+		_, err = fmt.Fprintln(w, line)
+	})
+	return err
+}
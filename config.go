@@ -0,0 +1,484 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Octogonapus/TerratestLogViewer/pkg/logviewer"
+)
+
+// The configuration of a run of the command, as given by its flags.
+type config struct {
+	owner               string
+	repo                string
+	workflowFilename    string
+	branch              string
+	prNumber            int
+	currentPR           bool
+	sha                 string
+	runID               int64
+	maxRuns             int
+	searchOrg           bool
+	maxRepos            int
+	status              string
+	conclusion          string
+	jobName             string
+	testNames           testNameList
+	testRegex           string
+	testPrefix          string
+	format              string
+	removePrefix        bool
+	echoConfig          bool
+	summary             bool
+	onlyTerraformErrors bool
+	filter              string
+	since               string
+	until               string
+	timestamps          string
+	timestampLayout     string
+	assertContains      string
+	assertNotContains   string
+	explain             bool
+	verbose             bool
+	showRunURL          bool
+	headLines           int
+	tailLines           int
+	maxLines            int
+	wrapWidth           int
+	truncateWidth       int
+	outputPath          string
+	failFast            bool
+	stripANSI           bool
+	color               string
+	noColor             bool
+	contextLines        int
+	quiet               bool
+	dedup               bool
+	compact             bool
+	squeezeBlank        bool
+	indent              bool
+	section             string
+	stage               string
+	includeSetup        bool
+	highlightPlan       bool
+	afterLine           string
+	beforeLine          string
+	excludeAnchors      bool
+	redact              bool
+	redactPatterns      patternList
+	failOnError         bool
+	downloadAttempts    int
+	downloadRetryDelay  time.Duration
+	listTests           bool
+	flaky               bool
+	count               bool
+	splitByTest         bool
+	outputDir           string
+	dryRun              bool
+	listJobs            bool
+	allJobs             bool
+	wholeRun            bool
+	inputPath           string
+	timeout             time.Duration
+	waitForRun          time.Duration
+	runAfter            string
+	headCommitTime      time.Time
+	watch               bool
+	watchInterval       time.Duration
+	noCache             bool
+	clearCache          bool
+	appID               int64
+	appInstallationID   int64
+	appPrivateKeyPath   string
+	proxy               string
+	clientCertPath      string
+	clientKeyPath       string
+	caBundlePath        string
+	githubURL           string
+	useGHAuth           bool
+	tokenFile           string
+	// the GitHub token from the token file or the GITHUB_TOKEN environment variable, if hasToken
+	token    string
+	hasToken bool
+	// the subcommand given before the flags, or empty if there is none
+	subcommand string
+	// whether the logs are output as they were read, without filtering or formatting them, as by the fetch subcommand
+	raw bool
+	// the flags which were given rather than left at their defaults
+	setFlags map[string]bool
+}
+
+// The name of the command, used in its usage and completion scripts.
+const programName = "TerratestLogViewer"
+
+// The name of the file in the working directory which supplies defaults for flags which are not given on the commandline.
+const configFileName = ".terratestlogviewer.yml"
+
+// A subcommand, which presets the flags of a common task so that the tasks compose, e.g. fetch | filter --test TestFoo.
+// The flags are the same for every subcommand.
+type subcommand struct {
+	name        string
+	usage       string
+	description string
+}
+
+// The subcommands, in the order they are listed in the usage. Running without a subcommand, which downloads and filters the logs
+// in one step, is deprecated but still supported.
+var subcommands = []subcommand{
+	{name: "fetch", usage: "fetch [flags]", description: "Downloads the logs and outputs them as they are, without filtering or formatting them."},
+	{name: "filter", usage: "filter [flags] [file]", description: "Filters the logs in the given file, or in stdin if there is none, e.g. the output of fetch."},
+	{name: "summary", usage: "summary [flags]", description: "Outputs only a summary of passed/failed/skipped tests, like --summary."},
+	{name: "list-jobs", usage: "list-jobs [flags]", description: "Prints the name and conclusion of each job in the run, like --list-jobs."},
+	{name: "list-tests", usage: "list-tests [flags]", description: "Outputs only the name of each top-level test in the logs and how many lines it logged, like --list-tests."},
+}
+
+// Returns the configuration given by the given commandline arguments, which exclude the program name,
+// with defaults for the flags which were not given read from the YAML config file at configPath if it exists.
+// The arguments may start with the name of a subcommand.
+func parseConfig(args []string, configPath string) (*config, error) {
+	c := &config{setFlags: map[string]bool{}}
+	if len(args) > 0 {
+		for _, command := range subcommands {
+			if args[0] == command.name {
+				c.subcommand = command.name
+				args = args[1:]
+				break
+			}
+		}
+	}
+	flags := newFlagSet(c)
+	if err := flags.Parse(args); err != nil {
+		return nil, flagParseError{err: err}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		c.setFlags[f.Name] = true
+	})
+	if len(configPath) > 0 {
+		if err := applyConfigFile(flags, configPath, c.setFlags); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.applySubcommand(flags.Args()); err != nil {
+		return nil, err
+	}
+	c.token, c.hasToken = os.LookupEnv("GITHUB_TOKEN")
+	if !c.setFlags["github-url"] {
+		c.githubURL = os.Getenv("GITHUB_API_URL")
+	}
+	// any non-empty value disables color, see https://no-color.org
+	c.noColor = len(os.Getenv("NO_COLOR")) > 0
+
+	if !c.setFlags["strip-ansi"] {
+		// color codes show up as garbage such as [0m in files and pagers
+		c.stripANSI = len(c.outputPath) > 0 || !isTerminal(os.Stdout)
+	}
+	return c, nil
+}
+
+// An error in the commandline arguments which the flag package has already printed along with the usage.
+type flagParseError struct {
+	err error
+}
+
+func (e flagParseError) Error() string {
+	return e.err.Error()
+}
+
+func (e flagParseError) Unwrap() error {
+	return e.err
+}
+
+// Sets the flags preset by the subcommand, given the arguments which follow its flags.
+func (c *config) applySubcommand(args []string) error {
+	if len(c.subcommand) > 0 && !c.setFlags["echo-config"] {
+		// the output of one subcommand is often the input of another
+		c.echoConfig = false
+	}
+	if len(c.subcommand) == 0 && len(args) > 0 {
+		// the flags after an unknown subcommand would not be parsed
+		return usageError{err: fmt.Errorf("unknown subcommand %s. see usage via --help", args[0])}
+	}
+	if c.subcommand != "filter" && len(args) > 0 {
+		return usageError{err: fmt.Errorf("unexpected argument %s. see usage via --help", args[0])}
+	}
+
+	switch c.subcommand {
+	case "fetch":
+		if len(c.testNames) > 0 || len(c.testRegex) > 0 {
+			return usageError{err: errors.New("fetch outputs every line of the logs, filter them with the filter subcommand instead. see usage via --help")}
+		}
+		if c.format != "text" {
+			// the lines of the logs would be numbered and formatted, so they could no longer be filtered later
+			return usageError{err: errors.New("fetch outputs the logs as they are, format them with the filter subcommand instead. see usage via --help")}
+		}
+		c.raw = true
+		if !c.setFlags["color"] {
+			c.color = "never"
+		}
+	case "filter":
+		if len(args) > 1 {
+			return usageError{err: fmt.Errorf("unexpected argument %s. see usage via --help", args[1])}
+		}
+		if len(args) == 1 && len(c.inputPath) > 0 {
+			return usageError{err: errors.New("filter reads either the given file or --input. see usage via --help")}
+		}
+		if len(args) == 1 {
+			c.inputPath = args[0]
+		} else if len(c.inputPath) == 0 {
+			c.inputPath = "-"
+		}
+	case "summary":
+		c.summary = true
+	case "list-jobs":
+		c.listJobs = true
+	case "list-tests":
+		c.listTests = true
+	}
+	return nil
+}
+
+// Writes the usage of the command and its subcommands, followed by the usage of the given flags, to the output of the flags.
+func writeUsage(flags *flag.FlagSet) {
+	w := flags.Output()
+	fmt.Fprintf(w, "Usage: %s [subcommand] [flags]\n\nSubcommands:\n", programName)
+	for _, command := range subcommands {
+		fmt.Fprintf(w, "  %s\n    \t%s\n", command.usage, command.description)
+	}
+	fmt.Fprintf(w, "Without a subcommand, which is deprecated, the logs are downloaded and filtered in one step.\n\nFlags:\n")
+	flags.PrintDefaults()
+}
+
+// Returns the flags of the command, which set the fields of the given config when parsed.
+func newFlagSet(c *config) *flag.FlagSet {
+	flags := flag.NewFlagSet(programName, flag.ContinueOnError)
+	flags.Usage = func() { writeUsage(flags) }
+	flags.StringVar(&c.owner, "owner", "", "Repository owner name. Will be parsed from the local git repository if not specified.")
+	flags.StringVar(&c.repo, "repository", "", "Repository name. Will be parsed from the local git repository if not specified.")
+	flags.StringVar(&c.workflowFilename, "workflow", "", "workflow filename, e.g. test.yml. A path such as .github/workflows/test.yml is reduced to its filename. Will be detected from the workflows in the local git repository which run go test if not specified.")
+	flags.StringVar(&c.branch, "branch", "", "Branch name. Will be parsed from the local git repository if not specified.")
+	flags.IntVar(&c.prNumber, "pr", 0, "Pull request number. Selects the latest run for the pull request's head commit instead of the latest run on the branch.")
+	flags.BoolVar(&c.currentPR, "current-pr", false, "Selects the latest run for the head commit of the open pull request for the branch. Falls back to the latest run on the branch if there is no open pull request.")
+	flags.StringVar(&c.sha, "sha", "", "Commit SHA. Selects the latest run for this commit instead of the latest run on the branch. An abbreviated SHA is expanded using the local git repository.")
+	flags.Int64Var(&c.runID, "run-id", 0, "Workflow run ID. The latest run matching the other parameters is used if not specified.")
+	flags.IntVar(&c.maxRuns, "max-runs", 1, "Searches up to this many of the latest matching runs for the most recent one which logged the selected tests, e.g. when a test was skipped in the latest run. Requires --test or --regex.")
+	flags.BoolVar(&c.searchOrg, "search-org", false, "Searches the repositories of the organization given by --owner for the most recently pushed one whose latest runs of --workflow logged the selected tests, e.g. when it is not known which repository ran the test. Searches --max-runs runs of each repository on --branch, or on its default branch if not specified. This makes several API requests per repository. Requires --owner, --workflow, and --test or --regex, and merges the logs of every job unless --job is given.")
+	flags.IntVar(&c.maxRepos, "max-repos", 20, "Searches up to this many of the most recently pushed repositories with --search-org.")
+	flags.StringVar(&c.status, "status", "completed", "Selects the latest run with this status, one of completed, in_progress, queued, or any. Runs which have not completed have incomplete logs.")
+	flags.StringVar(&c.conclusion, "conclusion", "", "Selects the latest run with this conclusion, one of failure, success, or cancelled, e.g. to debug the latest failed run.")
+	flags.StringVar(&c.jobName, "job", "", "job name (within the workflow file), or a pattern such as 'test (*)' which matches one job. Will be detected from the job in the workflow file which runs go test if not specified.")
+	flags.Var(&c.testNames, "test", "Go test name. May be repeated or comma-separated to select several tests. All log data is returned otherwise.")
+	flags.StringVar(&c.testRegex, "regex", "", "Regular expression matched against the test name at the start of each log line. Selects all matching tests instead of --test.")
+	flags.StringVar(&c.testPrefix, "test-prefix", logviewer.DefaultTestPrefix, "Prefix of the names of tests, which marks where the logs of a new test start. Change it for a harness whose tests are not named like TestFoo.")
+	flags.StringVar(&c.format, "format", "text", "Output format, one of text, json, junit, or markdown. The json format outputs one object per log line, with its test, timestamp, message, and 1-based raw_line number in the raw logs of its job, and only supports filtering by --test or --regex. The junit format outputs a JUnit XML report of the test results. The markdown format groups the logs of each test into a collapsible block, e.g. for a pull request comment.")
+	flags.BoolVar(&c.removePrefix, "remove-prefix", true, "Removes the test name prefix from each log line in the text, json, and markdown formats. Keep it to tell apart the lines of several selected tests, or of subtests.")
+	flags.BoolVar(&c.echoConfig, "echo-config", true, "Echoes the parsed/given flags to stdout.")
+	flags.BoolVar(&c.summary, "summary", false, "Outputs only a summary of passed/failed/skipped tests. Combine with --test or --regex to summarize only the selected tests.")
+	flags.BoolVar(&c.onlyTerraformErrors, "only-terraform-errors", false, "Outputs only Terraform error diagnostics, prefixed by the test which logged them.")
+	flags.BoolVar(&c.onlyTerraformErrors, "errors-only", false, "Same as --only-terraform-errors.")
+	flags.StringVar(&c.filter, "filter", "", `Outputs only log lines selected by an expression over their test, timestamp, and message, e.g. 'test == "TestFoo" && message contains "Error"'. Strings are compared with ==, !=, contains, and matches, timestamps with ==, !=, <, <=, >, and >=, and comparisons combine with &&, ||, !, and parentheses.`)
+	flags.StringVar(&c.since, "since", "", "Outputs only log lines timestamped at or after this time. Either an RFC 3339 timestamp or a duration after the start of the run, e.g. 10m.")
+	flags.StringVar(&c.until, "until", "", "Outputs only log lines timestamped at or before this time. Either an RFC 3339 timestamp or a duration after the start of the run, e.g. 25m.")
+	flags.StringVar(&c.timestamps, "timestamps", "strip", "How to output the timestamp at the start of each log line in text output, one of strip, keep, or local. local reformats the timestamp in the local timezone.")
+	flags.StringVar(&c.timestampLayout, "ts-layout", "", "Go time layout of the timestamp at the start of each log line. Defaults to RFC 3339. Lines whose timestamp does not parse with this layout are left unchanged.")
+	flags.StringVar(&c.assertContains, "assert-contains", "", "Exits with a non-zero status if the output logs do not contain this string. Only supported by text output.")
+	flags.StringVar(&c.assertNotContains, "assert-not-contains", "", "Exits with a non-zero status if the output logs contain this string. Only supported by text output.")
+	flags.BoolVar(&c.explain, "explain", false, "Describes how the logs were found and processed on stderr.")
+	flags.BoolVar(&c.verbose, "verbose", false, "Logs each step of finding, downloading, and filtering the logs to stderr as it happens, including the line count after each filter stage.")
+	flags.BoolVar(&c.showRunURL, "show-run-url", false, "Prints the URL of the run which the logs were downloaded from to stderr before the logs.")
+	flags.IntVar(&c.headLines, "head", 0, "Keeps only the first this many lines of the processed logs, e.g. to see a test's setup. The rest of the logs are not read, unless --fail-on-error needs to check them for a failure. Disabled when zero.")
+	flags.IntVar(&c.tailLines, "tail", 0, "Keeps only the last this many lines of the processed logs, e.g. to see a test's failure. Disabled when zero.")
+	flags.IntVar(&c.wrapWidth, "wrap", 0, "Soft-wraps lines longer than this many characters in text output, breaking at spaces where possible. Disabled when zero.")
+	flags.IntVar(&c.truncateWidth, "truncate", 0, "Cuts lines longer than this many characters in text output, ending them with an ellipsis. Disabled when zero.")
+	flags.IntVar(&c.maxLines, "max-lines", 0, "Truncates the output to this many lines when printing to stdout. Disabled when zero.")
+	flags.StringVar(&c.outputPath, "output", "", "Writes the output to this file instead of stdout.")
+	flags.BoolVar(&c.failFast, "fail-fast", false, "Stops outputting logs after the first test block which contains a failure.")
+	flags.BoolVar(&c.stripANSI, "strip-ansi", false, "Removes ANSI color codes from the logs in text output. Enabled by default when the output is not a terminal.")
+	flags.StringVar(&c.color, "color", "auto", "Colorizes test results and Terraform errors in text output to stdout, one of auto, always, or never. auto colorizes only when stdout is a terminal and the NO_COLOR environment variable is not set.")
+	flags.IntVar(&c.contextLines, "context", 0, "Number of lines of context to output before and after each diagnostic with --only-terraform-errors.")
+	flags.BoolVar(&c.quiet, "quiet", false, "Drops benign Terraform progress lines, such as Creating... and Refreshing state...")
+	flags.BoolVar(&c.dedup, "dedup", false, "Collapses consecutive identical log lines into one line followed by a repeat count, e.g. (x3).")
+	flags.BoolVar(&c.compact, "compact", false, "Removes blank and whitespace-only lines from text output.")
+	flags.BoolVar(&c.squeezeBlank, "squeeze-blank", false, "Collapses each run of blank and whitespace-only lines in text output into one blank line.")
+	flags.BoolVar(&c.indent, "indent", false, "Indents the lines logged by subtests once per level of nesting in text output, e.g. once for TestA/foo, so that the logs read like a tree.")
+	flags.StringVar(&c.section, "section", "", "Outputs only the lines of the given kind of section of the Terraform output. The only supported section is apply.")
+	flags.StringVar(&c.stage, "stage", "", "Outputs only the lines of the given test_structure stage, e.g. deploy, from its stage marker until the next stage marker.")
+	flags.BoolVar(&c.includeSetup, "include-setup", false, "Also outputs the lines logged before the first test in text output, e.g. by TestMain or other package-level setup, which often contain setup failures. Only used with --test or --regex.")
+	flags.BoolVar(&c.highlightPlan, "highlight-plan", false, "Lines up the +, -, and ~ change indicators of Terraform plans in text output like a diff, colorizing them like --color.")
+	flags.StringVar(&c.afterLine, "after-line", "", "Outputs only the lines from the first line containing this string, e.g. 'RunTestStage: deploy'. Combine with --before-line to output the region between two markers.")
+	flags.StringVar(&c.beforeLine, "before-line", "", "Outputs only the lines until the first line containing this string, after the --after-line line if given. The rest of the logs are not read.")
+	flags.BoolVar(&c.excludeAnchors, "exclude-anchors", false, "Excludes the --after-line and --before-line lines themselves from the output.")
+	flags.BoolVar(&c.redact, "redact", false, "Replaces values which look like secrets, such as AWS access keys, 40 character secret keys, and bearer tokens, with ***REDACTED*** in the output.")
+	flags.Var(&c.redactPatterns, "redact-pattern", "Regular expression of an additional secret to replace with ***REDACTED***. If it has a submatch, only the first submatch is replaced. May be repeated. Implies --redact.")
+	flags.BoolVar(&c.failOnError, "fail-on-error", false, "Exits with a non-zero status if the logs of the selected tests contain a test failure.")
+	flags.IntVar(&c.downloadAttempts, "download-attempts", 3, "Number of attempts made to download the logs when the download fails with a server or network error.")
+	flags.DurationVar(&c.downloadRetryDelay, "download-retry-delay", time.Second, "Delay before the first retry of a failed log download. Doubles with each retry.")
+	flags.BoolVar(&c.listTests, "list-tests", false, "Outputs only the name of each top-level test in the logs and how many lines it logged.")
+	flags.BoolVar(&c.flaky, "flaky", false, "Outputs only the name of each test which passed after failing, e.g. in a retry loop or a rerun, and how many times it failed. Combine with --test or --regex to report only the selected tests.")
+	flags.BoolVar(&c.count, "count", false, "Outputs only the number of lines, the number of lines of the selected tests, and the number of passed, failed, and skipped tests instead of the logs.")
+	flags.BoolVar(&c.splitByTest, "split-by-test", false, "Writes the lines of each test to its own file in --output-dir, e.g. TestFoo.log, and the lines which are not part of any test to _unattributed.log. Outputs only the name of each file and how many lines it has.")
+	flags.StringVar(&c.outputDir, "output-dir", "", "Directory to write the files of --split-by-test to. It is created if it does not exist.")
+	flags.BoolVar(&c.dryRun, "dry-run", false, "Prints the resolved parameters, including the selected run and job, then exits without downloading the logs.")
+	flags.BoolVar(&c.listJobs, "list-jobs", false, "Prints the name and conclusion of each job in the run, then exits.")
+	flags.BoolVar(&c.allJobs, "all-jobs", false, "Merges the logs of every job in the run instead of reading the logs of one job, e.g. for matrix workflows. The logs of each job are preceded by a separator line with the job's name. Combine with a --job pattern to merge only the matching jobs.")
+	flags.BoolVar(&c.wholeRun, "whole-run", false, "Merges the logs of every job in the run like --all-jobs, but downloads the log archive of the whole run in one request, e.g. when you don't know which job ran the test. --job is not used, and the logs are not cached.")
+	flags.StringVar(&c.inputPath, "input", "", "Reads the raw logs from this file, or from stdin if it is -, instead of downloading them from GitHub. The git repository and GitHub flags are not used.")
+	flags.DurationVar(&c.timeout, "timeout", time.Minute, "Timeout for finding and downloading the logs from GitHub.")
+	flags.DurationVar(&c.waitForRun, "wait-for-run", 0, "Waits up to this long for a matching run created after --run-after to be listed, e.g. when the workflow was just triggered by a push and GitHub still lists only older runs. This is not part of --timeout.")
+	flags.StringVar(&c.runAfter, "run-after", "", "RFC 3339 timestamp which the run waited for by --wait-for-run was created after. Defaults to the commit time of git HEAD, or to any time if the run is selected by its commit.")
+	flags.BoolVar(&c.watch, "watch", false, "Follows the logs of a job which is still running, outputting new lines as they appear until the job completes. Selects the latest run whatever its status unless --status is given. GitHub only serves the logs of a job once they have been uploaded, which may only be after some or all of its steps have finished. --timeout does not apply.")
+	flags.DurationVar(&c.watchInterval, "watch-interval", 10*time.Second, "Delay between polls for new logs with --watch.")
+	flags.BoolVar(&c.noCache, "no-cache", false, "Looks up the workflow run and job and downloads the logs even if they are cached, and does not cache them.")
+	flags.BoolVar(&c.clearCache, "clear-cache", false, "Removes all cached logs, then exits.")
+	flags.StringVar(&c.tokenFile, "token-file", "", "Path to a file containing the GitHub token to authenticate with instead of GITHUB_TOKEN, e.g. a secret mounted by a CI system. Read from GITHUB_TOKEN_FILE if not specified.")
+	flags.BoolVar(&c.useGHAuth, "use-gh-auth", false, "Authenticates with the token of the gh CLI, as output by gh auth token, if neither --token-file nor GITHUB_TOKEN is given.")
+	flags.Int64Var(&c.appID, "app-id", 0, "GitHub App ID to authenticate as an app installation instead of with GITHUB_TOKEN. Read from GITHUB_APP_ID if not specified.")
+	flags.Int64Var(&c.appInstallationID, "app-installation-id", 0, "GitHub App installation ID. Read from GITHUB_APP_INSTALLATION_ID if not specified.")
+	flags.StringVar(&c.appPrivateKeyPath, "app-private-key", "", "Path to the GitHub App's PEM private key. Read from GITHUB_APP_PRIVATE_KEY_PATH if not specified.")
+	flags.StringVar(&c.proxy, "proxy", "", "URL of the proxy to send the GitHub API requests and log downloads through, e.g. http://proxy.example.com:3128. Read from HTTPS_PROXY and HTTP_PROXY if not specified.")
+	flags.StringVar(&c.clientCertPath, "client-cert", "", "Path to a PEM client certificate to present to the GitHub API and log storage, e.g. for a GitHub Enterprise installation behind mutual TLS. Requires --client-key.")
+	flags.StringVar(&c.clientKeyPath, "client-key", "", "Path to the PEM private key of the --client-cert certificate.")
+	flags.StringVar(&c.githubURL, "github-url", "", "Base URL of the API of a GitHub Enterprise installation, e.g. https://github.example.com/api/v3/. Read from GITHUB_API_URL if not specified, and defaults to https://api.github.com.")
+	flags.StringVar(&c.caBundlePath, "ca-bundle", "", "Path to a PEM bundle of certificate authorities to trust in addition to the system ones, e.g. the internal CA of a GitHub Enterprise installation.")
+	return flags
+}
+
+// Sets each flag in the given YAML config file which is not in setFlags, then adds it to setFlags.
+// The keys of the file are flag names, e.g. workflow, and a list sets a repeatable flag such as test once per item.
+// The file is ignored if it does not exist.
+func applyConfigFile(flags *flag.FlagSet, path string, setFlags map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	values := map[string]yaml.Node{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if flags.Lookup(key) == nil {
+			return fmt.Errorf("failed to parse %s: unknown flag %s", path, key)
+		}
+		if setFlags[key] {
+			continue
+		}
+		node := values[key]
+		items := []*yaml.Node{&node}
+		if node.Kind == yaml.SequenceNode {
+			items = node.Content
+		}
+		for _, item := range items {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("failed to parse %s: %s must be a value or a list of values", path, key)
+			}
+			if err := flags.Set(key, item.Value); err != nil {
+				return fmt.Errorf("failed to parse %s: invalid value for %s: %w", path, key, err)
+			}
+		}
+		setFlags[key] = true
+	}
+	return nil
+}
+
+// Fills in the owner, repo, workflow, branch, commit, and job which were not given using the local git repository.
+// Returns notes about each resolution step for --explain, and logs each detected value to logger.
+func (c *config) resolveGitDefaults(logger *log.Logger) ([]string, error) {
+	explanation := []string{}
+	dir, err := logviewer.FindGitDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find git dir: %w", err)
+	}
+	r, gitErr := git.PlainOpen(dir)
+
+	if len(c.owner) == 0 && len(c.repo) == 0 {
+		if gitErr != nil {
+			return nil, fmt.Errorf("failed to open git repo: %w", gitErr)
+		}
+		parsedOwner, parsedRepo, err := logviewer.ParseRemoteOwnerAndRepo(r)
+		if err != nil {
+			return nil, err
+		}
+		c.owner = parsedOwner
+		c.repo = parsedRepo
+		logger.Printf("detected owner/repo %s/%s from the git remote", c.owner, c.repo)
+		explanation = append(explanation, "resolved owner/repo from git remote")
+	} else if len(c.owner) == 0 {
+		return nil, usageError{err: errors.New("owner is a required parameter. see usage via --help")}
+	} else if len(c.repo) == 0 {
+		return nil, usageError{err: errors.New("repo is a required parameter. see usage via --help")}
+	}
+	if len(c.workflowFilename) == 0 && c.runID == 0 {
+		parsedWorkflowFilename, err := logviewer.FindTestWorkflow(filepath.Join(filepath.Dir(dir), ".github", "workflows"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect workflowFilename, specify it via --workflow: %w", err)
+		}
+		c.workflowFilename = parsedWorkflowFilename
+		logger.Printf("detected workflow %s", c.workflowFilename)
+		explanation = append(explanation, "detected workflow "+parsedWorkflowFilename+" from .github/workflows")
+	}
+	if len(c.branch) == 0 && len(c.sha) == 0 && c.prNumber == 0 && c.runID == 0 {
+		if gitErr != nil {
+			return nil, fmt.Errorf("failed to open git repo: %w", gitErr)
+		}
+		parsedBranch, err := logviewer.ParseBranch(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect branch, specify it via --branch: %w", err)
+		}
+		c.branch = parsedBranch
+		logger.Printf("detected branch %s from git HEAD", c.branch)
+		explanation = append(explanation, "resolved branch from git HEAD")
+	}
+	// the API only finds runs by their full commit SHA
+	if len(c.sha) > 0 && len(c.sha) < 40 {
+		if gitErr != nil {
+			return nil, fmt.Errorf("failed to open git repo to expand commit %s, specify the full SHA: %w", c.sha, gitErr)
+		}
+		hash, err := r.ResolveRevision(plumbing.Revision(c.sha))
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand commit %s, specify the full SHA: %w", c.sha, err)
+		}
+		c.sha = hash.String()
+		logger.Printf("expanded commit to %s", c.sha)
+		explanation = append(explanation, "expanded commit "+c.sha+" from git")
+	}
+	// a run selected by its commit is new enough however old the commit is
+	if c.waitForRun > 0 && len(c.runAfter) == 0 && len(c.sha) == 0 && c.prNumber == 0 && !c.currentPR {
+		if gitErr != nil {
+			return nil, fmt.Errorf("failed to open git repo to find the commit time of HEAD, specify it via --run-after: %w", gitErr)
+		}
+		committed, err := logviewer.ParseHeadCommitTime(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the commit time of HEAD, specify it via --run-after: %w", err)
+		}
+		c.headCommitTime = committed
+		logger.Printf("waiting for a run created after the commit time of git HEAD, %s", committed.Format(time.RFC3339))
+	}
+	if len(c.jobName) == 0 && !c.listJobs && !c.allJobs && !c.wholeRun {
+		parsedJobName, err := logviewer.FindTestJob(filepath.Join(filepath.Dir(dir), ".github", "workflows", c.workflowFilename))
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect jobName, specify it via --job: %w", err)
+		}
+		c.jobName = parsedJobName
+		logger.Printf("detected job '%s'", c.jobName)
+		explanation = append(explanation, "detected job '"+parsedJobName+"' from the workflow")
+	}
+	return explanation, nil
+}
@@ -1,330 +1,1022 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"path"
+	"reflect"
 	"regexp"
+	"runtime"
 	"strings"
+	"time"
 
-	"github.com/go-git/go-git/v5"
 	"github.com/google/go-github/v52/github"
-	"golang.org/x/oauth2"
+
+	"github.com/Octogonapus/TerratestLogViewer/pkg/logviewer"
 )
 
-var gitRegex = regexp.MustCompile(`((git@|http(s)?:\/\/)([\w\.@]+)(\/|:))([\w,\-,\_]+)\/([\w,\-,\_]+)(.git){0,1}((\/){0,1})`)
+// How often the runs are listed again while waiting for a run with --wait-for-run.
+const waitForRunInterval = 5 * time.Second
 
 func main() {
-	owner := flag.String("owner", "", "Repository owner name. Will be parsed from the local git repository if not specified.")
-	repo := flag.String("repository", "", "Repository name. Will be parsed from the local git repository if not specified.")
-	workflowFilename := flag.String("workflow", "", "workflow filename (base filename, not path)")
-	branch := flag.String("branch", "", "Branch name. Will be parsed from the local git repository if not specified.")
-	jobName := flag.String("job", "", "job name (within the workflow file)")
-	testName := flag.String("test", "", "Go test name. All log data is returned otherwise.")
-	removePrefix := flag.Bool("remove-prefix", true, "Removes the test name prefix from each log line.")
-	echoConfig := flag.Bool("echo-config", true, "Echoes the parsed/given flags to stdout.")
-	summary := flag.Bool("summary", false, "Outputs only a summary of passed/failed tests.")
-	token, hasToken := os.LookupEnv("GITHUB_TOKEN")
-
-	flag.Parse()
-
-	dir, err := findGitDir()
-	if err != nil {
-		panic(fmt.Errorf("failed to find git dir: %w", err))
+	if len(os.Args) > 1 && os.Args[1] == "completion" {
+		shell := ""
+		if len(os.Args) == 3 {
+			shell = os.Args[2]
+		}
+		if err := writeCompletionScript(os.Stdout, shell); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+		return
+	}
+
+	c, err := parseConfig(os.Args[1:], configFileName)
+	var parseErr flagParseError
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if errors.As(err, &parseErr) {
+		// the flag package has already printed the error along with the usage
+		os.Exit(exitUsage)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	if err := run(c); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// The exit codes of the command, so that scripts can tell its failures apart. 0 is success.
+const (
+	// the logs contain a test failure with --fail-on-error, or any error which is not one of the others
+	exitFailure = 1
+	// the commandline arguments or config file are invalid
+	exitUsage = 2
+	// no workflow run matches the options
+	exitNoRuns = 3
+	// no job, or more than one job, matches --job
+	exitJobNotFound = 4
+	// a request to GitHub or a download of the logs failed
+	exitNetwork = 5
+)
+
+// Returned by run when the logs contain a test failure with --fail-on-error.
+var errTestFailure = errors.New("logs contain a test failure")
+
+// An invalid commandline argument or combination of arguments, which exits with exitUsage, e.g. a regex which does not compile.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+// Returns the exit code of the command for the given error returned by run.
+func exitCode(err error) int {
+	var usageErr usageError
+	var apiErr *github.ErrorResponse
+	var rateLimitErr *github.RateLimitError
+	var abuseRateLimitErr *github.AbuseRateLimitError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errTestFailure):
+		return exitFailure
+	case errors.As(err, &usageErr) || errors.Is(err, logviewer.ErrIncompleteAppCredentials):
+		return exitUsage
+	case errors.Is(err, logviewer.ErrNoRuns):
+		return exitNoRuns
+	case errors.Is(err, logviewer.ErrJobNotFound) || errors.Is(err, logviewer.ErrLogsExpired):
+		return exitJobNotFound
+	case errors.Is(err, logviewer.ErrDownload) || errors.As(err, &apiErr) || errors.As(err, &rateLimitErr) || errors.As(err, &abuseRateLimitErr) ||
+		errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded):
+		return exitNetwork
+	default:
+		return exitFailure
+	}
+}
+
+// Runs the command. The returned error is printed to stderr by main.
+func run(c *config) error {
+	// logs each step for --verbose, and nothing otherwise
+	logger := log.New(io.Discard, "", 0)
+	if c.verbose {
+		logger = log.New(os.Stderr, "", log.Ltime|log.Lmicroseconds)
 	}
-	r, gitErr := git.PlainOpen(dir)
 
-	if len(*owner) == 0 && len(*repo) == 0 {
-		if gitErr != nil {
-			panic(fmt.Errorf("failed to open git repo: %w", gitErr))
+	if len(c.workflowFilename) > 0 {
+		workflowFilename, ok := logviewer.NormalizeWorkflowFilename(c.workflowFilename)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "workflow %s does not end in .yml or .yaml, workflows are selected by their filename rather than their name\n", workflowFilename)
 		}
-		parsedOwner, parsedRepo, err := parseRemoteOwnerAndRepo(r)
+		c.workflowFilename = workflowFilename
+	}
+
+	var cache *logviewer.LogCache
+	if c.clearCache || !c.noCache {
+		defaultCache, err := logviewer.DefaultLogCache()
 		if err != nil {
-			panic(err)
+			return err
 		}
-		*owner = parsedOwner
-		*repo = parsedRepo
-	} else if len(*owner) == 0 {
-		panic("owner is a required parameter. see usage via --help")
-	} else if len(*repo) == 0 {
-		panic("repo is a required parameter. see usage via --help")
+		cache = defaultCache
 	}
-	if len(*workflowFilename) == 0 {
-		panic("workflowFilename is a required parameter. see usage via --help")
+	if c.clearCache {
+		if err := cache.Clear(); err != nil {
+			return fmt.Errorf("failed to clear cache: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "cleared cache at %s\n", cache.Dir())
+		return nil
 	}
-	if len(*branch) == 0 {
-		if gitErr != nil {
-			panic(fmt.Errorf("failed to open git repo: %w", gitErr))
+
+	var matchesTest logviewer.TestMatcher
+	filterDescription := ""
+	if len(c.testRegex) > 0 {
+		if len(c.testNames) > 0 {
+			return usageError{err: errors.New("test and regex cannot be used together. see usage via --help")}
 		}
-		parsedBranch, err := parseBranch(r)
+		re, err := regexp.Compile(c.testRegex)
 		if err != nil {
-			panic(err)
+			return usageError{err: fmt.Errorf("failed to compile regex: %w", err)}
 		}
-		*branch = parsedBranch
-	}
-	if len(*jobName) == 0 {
-		panic("jobName is a required parameter. see usage via --help")
+		matchesTest = logviewer.TestRegexMatcher(re)
+		filterDescription = "tests matching " + c.testRegex
+	} else if len(c.testNames) > 0 {
+		matchesTest = logviewer.TestNamesMatcher(c.testNames.bytes())
+		filterDescription = c.testNames.String()
 	}
 
-	var gh *github.Client
-	if hasToken {
-		ctx := context.Background()
-		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-		tc := oauth2.NewClient(ctx, ts)
-		gh = github.NewClient(tc)
-	} else {
-		gh = github.NewClient(nil)
+	if len(c.jobName) > 0 {
+		// a malformed pattern would otherwise only be reported once the jobs of the run are listed
+		if _, err := path.Match(c.jobName, ""); err != nil {
+			return usageError{err: fmt.Errorf("invalid job pattern %s: %w", c.jobName, err)}
+		}
 	}
 
-	logs, err := getLogs(gh, *owner, *repo, *workflowFilename, *branch, *jobName)
+	if c.format != "text" && c.format != "json" && c.format != "junit" && c.format != "markdown" {
+		return usageError{err: errors.New("format must be one of text, json, junit, or markdown. see usage via --help")}
+	}
+	if c.wrapWidth > 0 && c.truncateWidth > 0 {
+		return usageError{err: errors.New("wrap and truncate cannot be used together. see usage via --help")}
+	}
+	if c.splitByTest != (len(c.outputDir) > 0) {
+		return usageError{err: errors.New("split-by-test and output-dir must be used together. see usage via --help")}
+	}
+	if c.watch && len(c.inputPath) > 0 {
+		return usageError{err: errors.New("watch and input cannot be used together. see usage via --help")}
+	}
+	if c.watch && c.allJobs {
+		return usageError{err: errors.New("watch and all-jobs cannot be used together. see usage via --help")}
+	}
+	if c.watch && c.maxRuns > 1 {
+		return usageError{err: errors.New("watch and max-runs cannot be used together. see usage via --help")}
+	}
+	if c.compact && c.squeezeBlank {
+		return usageError{err: errors.New("compact and squeeze-blank cannot be used together. see usage via --help")}
+	}
+	if len(c.testPrefix) == 0 {
+		return usageError{err: errors.New("test-prefix must not be empty. see usage via --help")}
+	}
+	if len(c.section) > 0 && c.section != "apply" {
+		return usageError{err: errors.New("section must be apply. see usage via --help")}
+	}
+	if (len(c.assertContains) > 0 || len(c.assertNotContains) > 0) && (c.format != "text" || c.summary || c.listTests || c.flaky || c.count || c.splitByTest) {
+		// the assertions are about the logs, so they would silently pass against a report
+		return usageError{err: errors.New("assert-contains and assert-not-contains only check text output, so they cannot be used together with summary, list-tests, flaky, count, split-by-test, or another format. see usage via --help")}
+	}
+	var filter logviewer.LineFilter
+	if len(c.filter) > 0 {
+		parsedFilter, err := logviewer.ParseFilter(c.filter)
+		if err != nil {
+			return usageError{err: err}
+		}
+		filter = parsedFilter
+	}
+	var redactPatterns []*regexp.Regexp
+	if c.redact || len(c.redactPatterns) > 0 {
+		redactPatterns = append(redactPatterns, logviewer.RedactPatterns...)
+		for _, pattern := range c.redactPatterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return usageError{err: fmt.Errorf("failed to compile redact-pattern: %w", err)}
+			}
+			redactPatterns = append(redactPatterns, re)
+		}
+	}
+	since, err := logviewer.ParseTimeBound(c.since)
+	if err != nil {
+		return usageError{err: fmt.Errorf("failed to parse since: %w", err)}
+	}
+	until, err := logviewer.ParseTimeBound(c.until)
 	if err != nil {
-		panic(err)
+		return usageError{err: fmt.Errorf("failed to parse until: %w", err)}
+	}
+	if c.timestamps != "strip" && c.timestamps != "keep" && c.timestamps != "local" {
+		return usageError{err: errors.New("timestamps must be one of strip, keep, or local. see usage via --help")}
+	}
+	if c.color != "auto" && c.color != "always" && c.color != "never" {
+		return usageError{err: errors.New("color must be one of auto, always, or never. see usage via --help")}
+	}
+	if c.status != "completed" && c.status != "in_progress" && c.status != "queued" && c.status != "any" {
+		return usageError{err: errors.New("status must be one of completed, in_progress, queued, or any. see usage via --help")}
+	}
+	if len(c.conclusion) > 0 && c.conclusion != "failure" && c.conclusion != "success" && c.conclusion != "cancelled" {
+		return usageError{err: errors.New("conclusion must be one of failure, success, or cancelled. see usage via --help")}
+	}
+	if len(c.conclusion) > 0 && c.status != "completed" && c.status != "any" {
+		return usageError{err: errors.New("only completed runs have a conclusion, so conclusion requires status completed or any. see usage via --help")}
+	}
+	if len(c.sha) > 0 && (c.prNumber > 0 || c.currentPR) {
+		return usageError{err: errors.New("sha cannot be used together with pr or current-pr. see usage via --help")}
+	}
+	if c.maxRuns < 1 {
+		return usageError{err: errors.New("max-runs must be at least 1. see usage via --help")}
+	}
+	if c.excludeAnchors && len(c.afterLine) == 0 && len(c.beforeLine) == 0 {
+		return usageError{err: errors.New("exclude-anchors requires after-line or before-line. see usage via --help")}
+	}
+	if c.maxRuns > 1 && matchesTest == nil {
+		return usageError{err: errors.New("max-runs requires test or regex. see usage via --help")}
+	}
+	if c.maxRuns > 1 && c.runID != 0 {
+		return usageError{err: errors.New("max-runs and run-id cannot be used together. see usage via --help")}
+	}
+	if c.listJobs && len(c.inputPath) > 0 {
+		return usageError{err: errors.New("list-jobs and input cannot be used together. see usage via --help")}
+	}
+	if c.dryRun && len(c.inputPath) > 0 {
+		return usageError{err: errors.New("dry-run and input cannot be used together. see usage via --help")}
+	}
+	if c.allJobs && len(c.inputPath) > 0 {
+		return usageError{err: errors.New("all-jobs and input cannot be used together. see usage via --help")}
+	}
+	if c.waitForRun > 0 && len(c.inputPath) > 0 {
+		return usageError{err: errors.New("wait-for-run and input cannot be used together. see usage via --help")}
+	}
+	if c.waitForRun > 0 && c.runID != 0 {
+		return usageError{err: errors.New("wait-for-run and run-id cannot be used together. see usage via --help")}
+	}
+	if c.waitForRun > 0 && c.maxRuns > 1 {
+		return usageError{err: errors.New("wait-for-run and max-runs cannot be used together. see usage via --help")}
+	}
+	if c.searchOrg && len(c.inputPath) > 0 {
+		return usageError{err: errors.New("search-org and input cannot be used together. see usage via --help")}
+	}
+	if c.searchOrg && (len(c.owner) == 0 || len(c.workflowFilename) == 0) {
+		return usageError{err: errors.New("search-org requires owner and workflow, as they cannot be detected without a repository. see usage via --help")}
+	}
+	if c.searchOrg && matchesTest == nil {
+		return usageError{err: errors.New("search-org requires test or regex. see usage via --help")}
+	}
+	if c.searchOrg && (len(c.repo) > 0 || c.runID != 0 || len(c.sha) > 0 || c.prNumber > 0 || c.currentPR) {
+		return usageError{err: errors.New("search-org cannot be used together with repo, run-id, sha, pr, or current-pr, which select a run of one repository. see usage via --help")}
+	}
+	if c.searchOrg && (c.watch || c.waitForRun > 0 || c.listJobs || c.dryRun) {
+		return usageError{err: errors.New("search-org cannot be used together with watch, wait-for-run, list-jobs, or dry-run. see usage via --help")}
+	}
+	if c.maxRepos < 1 {
+		return usageError{err: errors.New("max-repos must be at least 1. see usage via --help")}
+	}
+	var runAfter time.Time
+	if len(c.runAfter) > 0 {
+		runAfter, err = time.Parse(time.RFC3339Nano, c.runAfter)
+		if err != nil {
+			return usageError{err: fmt.Errorf("failed to parse run-after: %w", err)}
+		}
+	}
+	if c.wholeRun && len(c.inputPath) > 0 {
+		return usageError{err: errors.New("whole-run and input cannot be used together. see usage via --help")}
+	}
+	if c.wholeRun && c.allJobs {
+		return usageError{err: errors.New("whole-run and all-jobs cannot be used together. see usage via --help")}
+	}
+	if c.wholeRun && c.watch {
+		return usageError{err: errors.New("whole-run and watch cannot be used together. see usage via --help")}
 	}
 
-	logs = removeTimestampPrefix(logs)
+	// the progress of downloads is written to stderr only when it is a terminal, as it would garble the output of other programs
+	// reading stderr, and only when the logs are not also written to the terminal
+	showProgress := len(c.inputPath) == 0 && isTerminal(os.Stderr) && (len(c.outputPath) > 0 || !isTerminal(os.Stdout))
 
-	if *summary {
-		fmt.Println(string(parseSummary(logs)))
-		return
-	}
+	// human readable notes about each resolution step, printed by --explain
+	explanation := []string{}
+
+	var logs io.ReadCloser
+	var source logviewer.LogSource
+	if len(c.inputPath) > 0 {
+		// the logs are already at hand, so there is nothing to find in git or GitHub
+		if c.inputPath == "-" {
+			logs = io.NopCloser(os.Stdin)
+			explanation = append(explanation, "read logs from stdin")
+		} else {
+			file, err := os.Open(c.inputPath)
+			if err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			logs = file
+			explanation = append(explanation, "read logs from "+c.inputPath)
+		}
+	} else {
+		if c.searchOrg {
+			// the job cannot be detected from the workflow file of a repository which is not known yet
+			if len(c.jobName) == 0 && !c.wholeRun {
+				c.allJobs = true
+			}
+		} else {
+			notes, err := c.resolveGitDefaults(logger)
+			if err != nil {
+				return err
+			}
+			explanation = append(explanation, notes...)
+		}
 
-	if len(*testName) > 0 {
-		logs, err = filterLogs(logs, []byte(*testName))
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if c.watch {
+			// the job is followed for as long as it runs
+			ctx, cancel = context.WithCancel(context.Background())
+		} else {
+			// the time spent waiting for the run is not part of the timeout
+			ctx, cancel = context.WithTimeout(context.Background(), c.timeout+c.waitForRun)
+		}
+		defer cancel()
+
+		app, err := logviewer.LoadAppCredentials(c.appID, c.appInstallationID, c.appPrivateKeyPath)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if app == nil {
+			// the token file takes precedence over GITHUB_TOKEN
+			token, ok, err := logviewer.LoadTokenFile(c.tokenFile)
+			if err != nil {
+				return err
+			}
+			if ok {
+				c.token, c.hasToken = token, true
+				logger.Printf("authenticating with the token in the token file")
+			}
+		}
+		if app == nil && !c.hasToken && c.useGHAuth {
+			c.token, err = logviewer.GHAuthToken(ctx)
+			if err != nil {
+				return err
+			}
+			c.hasToken = true
+			logger.Printf("authenticating with the token of the gh CLI")
+		}
+		httpClient, err := newHTTPClient(c.proxy, c.clientCertPath, c.clientKeyPath, c.caBundlePath)
+		if err != nil {
+			return err
+		}
+		gh, err := logviewer.NewGitHubClient(ctx, app, c.token, c.hasToken, httpClient, c.githubURL)
+		if err != nil {
+			return logviewer.DescribeTimeout("authenticating as the GitHub App", err)
+		}
+		client := &logviewer.Client{
+			GitHub: gh,
+			Cache:  cache,
+			Retry:  logviewer.RetryPolicy{Attempts: c.downloadAttempts, BaseDelay: c.downloadRetryDelay},
+			Logger: logger,
+			// the raw logs are downloaded without the GitHub credentials, but through the same proxy
+			HTTPClient: httpClient,
+		}
+		if showProgress {
+			client.Progress = progressPrinter(os.Stderr)
+		}
+
+		headSHA := c.sha
+		if c.prNumber > 0 {
+			pr, _, err := gh.PullRequests.Get(ctx, c.owner, c.repo, c.prNumber)
+			if err != nil {
+				return logviewer.DescribeTimeout("getting the pull request", fmt.Errorf("failed to get pull request #%d: %w", c.prNumber, err))
+			}
+			c.branch = pr.GetHead().GetRef()
+			headSHA = pr.GetHead().GetSHA()
+			explanation = append(explanation, fmt.Sprintf("resolved head commit %s from pull request #%d", headSHA, c.prNumber))
+		} else if c.currentPR {
+			pr, err := client.FindOpenPullRequest(ctx, c.owner, c.repo, c.branch)
+			if err != nil {
+				return logviewer.DescribeTimeout("finding the pull request", err)
+			}
+			if pr == nil {
+				fmt.Fprintf(os.Stderr, "no open pull request found for branch %s, using the latest run on the branch instead\n", c.branch)
+			} else {
+				headSHA = pr.GetHead().GetSHA()
+				explanation = append(explanation, fmt.Sprintf("resolved head commit %s from pull request #%d", headSHA, pr.GetNumber()))
+			}
+		}
+
+		// any status is selected by not filtering on it
+		status := c.status
+		if status == "any" || (c.watch && !c.setFlags["status"]) {
+			status = ""
+		}
+		fetchOptions := logviewer.FetchOptions{
+			Owner:      c.owner,
+			Repo:       c.repo,
+			Workflow:   c.workflowFilename,
+			Branch:     c.branch,
+			HeadSHA:    headSHA,
+			RunID:      c.runID,
+			Status:     status,
+			Conclusion: c.conclusion,
+			Job:        c.jobName,
+			AllJobs:    c.allJobs,
+			WholeRun:   c.wholeRun,
 		}
 
-		if *removePrefix {
-			logs = removeTestNamePrefix(logs, []byte(*testName))
+		if c.waitForRun > 0 {
+			after := runAfter
+			if after.IsZero() && len(headSHA) == 0 {
+				after = c.headCommitTime
+			}
+			waitCtx, cancelWait := context.WithTimeout(ctx, c.waitForRun)
+			run, err := client.WaitForRun(waitCtx, fetchOptions, after, waitForRunInterval)
+			cancelWait()
+			if err != nil {
+				return logviewer.DescribeRateLimit(err)
+			}
+			// the rest of the lookups use the run which was waited for, even if a newer run is listed in the meantime
+			fetchOptions.RunID = run.GetID()
+			explanation = append(explanation, fmt.Sprintf("waited for run #%d (id %d), created at %s", run.GetRunNumber(), run.GetID(), run.GetCreatedAt().Format(time.RFC3339)))
+		}
+
+		if c.listJobs {
+			latestRun, err := client.FindRun(ctx, fetchOptions)
+			if err != nil {
+				return logviewer.DescribeTimeout("finding the workflow run", logviewer.DescribeRateLimit(err))
+			}
+			jobs, err := client.ListJobs(ctx, c.owner, c.repo, latestRun.GetID())
+			if err != nil {
+				return logviewer.DescribeTimeout("listing the jobs", logviewer.DescribeRateLimit(err))
+			}
+			for _, job := range jobs {
+				// jobs which have not finished have no conclusion yet
+				conclusion := job.GetConclusion()
+				if len(conclusion) == 0 {
+					conclusion = job.GetStatus()
+				}
+				fmt.Printf("%s\t%s\n", job.GetName(), conclusion)
+			}
+			return nil
+		}
+
+		if c.dryRun {
+			latestRun, err := client.FindRun(ctx, fetchOptions)
+			if err != nil {
+				return logviewer.DescribeTimeout("finding the workflow run", logviewer.DescribeRateLimit(err))
+			}
+			var jobs []*github.WorkflowJob
+			if c.allJobs || c.wholeRun {
+				jobs, err = client.ListJobs(ctx, c.owner, c.repo, latestRun.GetID())
+				if err != nil {
+					return logviewer.DescribeTimeout("listing the jobs", logviewer.DescribeRateLimit(err))
+				}
+				if len(c.jobName) > 0 && !c.wholeRun {
+					jobs, err = logviewer.MatchJobs(jobs, c.jobName)
+					if err != nil {
+						return err
+					}
+				}
+			} else {
+				job, err := client.FindJob(ctx, c.owner, c.repo, latestRun.GetID(), c.jobName)
+				if err != nil {
+					return logviewer.DescribeTimeout("finding the job", logviewer.DescribeRateLimit(err))
+				}
+				jobs = []*github.WorkflowJob{job}
+			}
+			fmt.Printf("owner=%s\n", c.owner)
+			fmt.Printf("repo=%s\n", c.repo)
+			fmt.Printf("workflow filename=%s\n", c.workflowFilename)
+			fmt.Printf("branch=%s\n", c.branch)
+			fmt.Printf("head sha=%s\n", latestRun.GetHeadSHA())
+			fmt.Printf("run id=%d\n", latestRun.GetID())
+			for _, job := range jobs {
+				fmt.Printf("job name=%s\n", job.GetName())
+				fmt.Printf("job id=%d\n", job.GetID())
+			}
+			if len(c.testRegex) > 0 {
+				fmt.Printf("test regex=%s\n", c.testRegex)
+			} else {
+				fmt.Printf("test name=%s\n", c.testNames.String())
+			}
+			return nil
+		}
+
+		if c.watch {
+			logs, source, err = client.Watch(ctx, fetchOptions, c.watchInterval)
+		} else if c.searchOrg {
+			logs, source, err = client.SearchOrg(ctx, fetchOptions, c.maxRepos, c.maxRuns, matchesTest, c.timestampLayout)
+			if err == nil {
+				c.repo = source.Repo
+				explanation = append(explanation, fmt.Sprintf("found the selected tests in %s/%s", c.owner, c.repo))
+			}
+		} else if c.maxRuns > 1 {
+			logs, source, err = client.FetchWithTest(ctx, fetchOptions, c.maxRuns, matchesTest, c.timestampLayout)
+		} else {
+			logs, source, err = client.Fetch(ctx, fetchOptions)
+		}
+		if err != nil {
+			return err
+		}
+		logger.Printf("selected run %s", source.Run.GetHTMLURL())
+		if c.showRunURL {
+			fmt.Fprintf(os.Stderr, "logs from %s\n", source.Run.GetHTMLURL())
+		}
+		if source.RunsSkipped > 0 {
+			fmt.Fprintf(os.Stderr, "the latest %d runs did not log the selected tests, using run #%d (id %d) instead\n", source.RunsSkipped, source.Run.GetRunNumber(), source.Run.GetID())
+		}
+		explanation = append(explanation, fmt.Sprintf("selected run #%d (id %d, conclusion %s) on branch %s", source.Run.GetRunNumber(), source.Run.GetID(), source.Run.GetConclusion(), source.Run.GetHeadBranch()))
+		if c.wholeRun {
+			explanation = append(explanation, "merged the logs of every job from the log archive of the run")
+		} else if c.allJobs && len(c.jobName) > 0 {
+			explanation = append(explanation, "merged the logs of every job matching '"+c.jobName+"'")
+		} else if c.allJobs {
+			explanation = append(explanation, "merged the logs of every job")
+		} else {
+			explanation = append(explanation, fmt.Sprintf("matched job '%s' (id %d)", source.Job.GetName(), source.Job.GetID()))
+		}
+	}
+	defer logs.Close()
+
+	// only text output to a terminal is colorized, as the other formats and files are read by other programs
+	colorOutput := c.format == "text" && len(c.outputPath) == 0 && colorize(c.color, c.noColor, isTerminal(os.Stdout))
+	// the failure check sees the logs of the selected tests before they are truncated, so --head reads the rest of the logs for it
+	failed := false
+	availableTests := map[string]bool{}
+	// the transforms which follow the timestamps find the message after any kept timestamp, and localized timestamps are RFC 3339
+	keptLayout := ""
+	if c.timestamps == "keep" {
+		keptLayout = c.timestampLayout
+	}
+	transforms := []logviewer.Transform{}
+	if c.format == "json" && !c.listTests && !c.flaky && !c.splitByTest && !c.count {
+		// the lines are numbered before any are removed, so that each json line can point back to its line in the raw logs
+		transforms = append(transforms, logviewer.NumberRawLinesTransform())
+	}
+	if redactPatterns != nil {
+		// secrets are removed before anything else so that no output format can include them
+		transforms = append(transforms, logviewer.RedactTransform(redactPatterns))
+	}
+	if len(c.afterLine) > 0 || len(c.beforeLine) > 0 {
+		// the anchors are the first matches in the whole logs, rather than in the lines of the selected tests
+		transforms = append(transforms, logviewer.AnchorLinesTransform(c.afterLine, c.beforeLine, !c.excludeAnchors))
+	}
+	if since != nil || until != nil {
+		// the timestamps are needed to filter by time, so this runs before they are removed
+		transforms = append(transforms, logviewer.FilterTimeRangeTransform(c.timestampLayout, since, until, source.Run.GetRunStartedAt().Time))
+	}
+	if filter != nil {
+		// the timestamps are fields of the filter, so this also runs before they are removed
+		transforms = append(transforms, logviewer.FilterLinesTransform(filter, c.timestampLayout, c.testPrefix))
+	}
+	if c.listTests {
+		transforms = append(transforms, logviewer.RemoveTimestampPrefixTransform(c.timestampLayout), logviewer.ListTestsTransform(c.testPrefix))
+	} else if c.flaky {
+		transforms = append(transforms, logviewer.RemoveTimestampPrefixTransform(c.timestampLayout), logviewer.FlakinessReportTransform(matchesTest))
+	} else if c.splitByTest {
+		switch c.timestamps {
+		case "strip":
+			transforms = append(transforms, logviewer.RemoveTimestampPrefixTransform(c.timestampLayout))
+		case "local":
+			transforms = append(transforms, logviewer.LocalizeTimestampPrefixTransform(c.timestampLayout))
+		}
+		transforms = append(transforms, logviewer.SplitByTestTransform(matchesTest, c.outputDir, c.testPrefix, keptLayout))
+	} else if c.count {
+		transforms = append(transforms, logviewer.RemoveTimestampPrefixTransform(c.timestampLayout), logviewer.CountTransform(matchesTest, c.testPrefix))
+	} else if c.format == "json" {
+		transforms = append(transforms, logviewer.FormatJSONTransform(c.timestampLayout, matchesTest, c.removePrefix, c.testPrefix), logviewer.DetectFailureTransform(&failed))
+	} else if c.format == "junit" {
+		suiteName := c.jobName
+		if len(c.inputPath) > 0 {
+			suiteName = c.inputPath
+		}
+		// each failure's message is its result line, so failures are still detected in the report
+		transforms = append(transforms, logviewer.RemoveTimestampPrefixTransform(c.timestampLayout), logviewer.FormatJUnitTransform(suiteName, matchesTest), logviewer.DetectFailureTransform(&failed))
+	} else if c.format == "markdown" {
+		transforms = append(transforms, logviewer.RemoveTimestampPrefixTransform(c.timestampLayout), logviewer.FormatMarkdownTransform(matchesTest, c.removePrefix, c.testPrefix), logviewer.DetectFailureTransform(&failed))
+	} else if !c.raw {
+		switch c.timestamps {
+		case "strip":
+			transforms = append(transforms, logviewer.RemoveTimestampPrefixTransform(c.timestampLayout))
+		case "local":
+			transforms = append(transforms, logviewer.LocalizeTimestampPrefixTransform(c.timestampLayout))
+		}
+		if c.stripANSI {
+			transforms = append(transforms, logviewer.StripANSITransform())
+		}
+		if len(c.testNames) > 0 {
+			// used to suggest a test name if the selected tests have no logs, which is likely a typo
+			transforms = append(transforms, logviewer.CollectTestNamesTransform(availableTests, c.testPrefix, keptLayout))
+		}
+		if c.summary {
+			transforms = append(transforms, logviewer.ParseSummaryTransform(matchesTest), logviewer.DetectFailureTransform(&failed))
+		} else {
+			if matchesTest != nil {
+				if c.includeSetup {
+					transforms = append(transforms, logviewer.FilterLogsWithSetupTransform(matchesTest, c.testPrefix, keptLayout))
+				} else {
+					transforms = append(transforms, logviewer.FilterLogsWithTestPrefixTransform(matchesTest, c.testPrefix, keptLayout))
+				}
+			}
+			transforms = append(transforms, logviewer.DetectFailureTransform(&failed))
+			if c.section == "apply" {
+				transforms = append(transforms, logviewer.ExtractApplySectionsTransform())
+			}
+			if len(c.stage) > 0 {
+				transforms = append(transforms, logviewer.ExtractStageTransform(c.stage))
+			}
+			if c.onlyTerraformErrors {
+				transforms = append(transforms, logviewer.ExtractTerraformErrorsTransform(c.contextLines, c.testPrefix, keptLayout))
+			}
+			if c.failFast {
+				transforms = append(transforms, logviewer.TruncateAfterFirstFailureTransform(c.testPrefix, keptLayout))
+			}
+			if c.indent {
+				// the indentation follows the test name, so this runs before it is removed
+				transforms = append(transforms, logviewer.IndentSubtestsTransform(c.testPrefix, keptLayout))
+			}
+			if matchesTest != nil && c.removePrefix {
+				transforms = append(transforms, logviewer.RemoveTestNamePrefixTransform(matchesTest, keptLayout))
+			}
+			if c.quiet {
+				transforms = append(transforms, logviewer.DropTerraformProgressTransform())
+			}
+			// lines can be left blank by removing their test name, so this runs after it is removed
+			if c.compact || c.squeezeBlank {
+				transforms = append(transforms, logviewer.CompactLinesTransform(c.squeezeBlank, keptLayout))
+			}
+			if c.dedup {
+				transforms = append(transforms, logviewer.DedupLinesTransform(keptLayout))
+			}
+			if c.headLines > 0 {
+				transforms = append(transforms, logviewer.HeadLinesTransform(c.headLines, c.failOnError))
+			}
+			if c.tailLines > 0 {
+				transforms = append(transforms, logviewer.TailLinesTransform(c.tailLines))
+			}
+			if c.wrapWidth > 0 {
+				transforms = append(transforms, logviewer.WrapLinesTransform(c.wrapWidth))
+			}
+			if c.truncateWidth > 0 {
+				transforms = append(transforms, logviewer.TruncateLongLinesTransform(c.truncateWidth))
+			}
+			if c.highlightPlan {
+				// the widths above count the characters of the logs rather than of the color codes
+				transforms = append(transforms, logviewer.HighlightPlanTransform(colorOutput))
+			}
+			// the file is where the full logs get saved, so only the terminal output is capped
+			if c.maxLines > 0 && len(c.outputPath) == 0 {
+				transforms = append(transforms, logviewer.TruncateLinesTransform(c.maxLines))
+			}
 		}
 	}
 
-	if *echoConfig {
+	if c.echoConfig && c.format == "text" && !c.summary && !c.listTests && !c.flaky && !c.count && !c.splitByTest {
 		fmt.Println("Got configuration:")
-		fmt.Printf("owner=%s\n", *owner)
-		fmt.Printf("repo=%s\n", *repo)
-		fmt.Printf("workflow filename=%s\n", *workflowFilename)
-		fmt.Printf("branch=%s\n", *branch)
-		fmt.Printf("job name=%s\n", *jobName)
-		fmt.Printf("test name=%s\n", *testName)
+		if len(c.inputPath) > 0 {
+			fmt.Printf("input=%s\n", c.inputPath)
+		} else {
+			fmt.Printf("owner=%s\n", c.owner)
+			fmt.Printf("repo=%s\n", c.repo)
+			fmt.Printf("workflow filename=%s\n", c.workflowFilename)
+			fmt.Printf("branch=%s\n", c.branch)
+			if c.allJobs {
+				fmt.Println("all jobs=true")
+			}
+			if c.wholeRun {
+				fmt.Println("whole run=true")
+			} else if len(c.jobName) > 0 || !c.allJobs {
+				fmt.Printf("job name=%s\n", c.jobName)
+			}
+		}
+		fmt.Printf("test name=%s\n", c.testNames.String())
 		fmt.Println("You can turn this message off with --echo-config=false")
 		fmt.Println()
 	}
 
-	fmt.Println(string(logs))
-}
-
-func findGitDir() (string, error) {
-	dir, err := os.Getwd()
+	output, err := createOutput(c.outputPath)
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	for {
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			return "", err
+	bufferedOutput := bufio.NewWriter(output)
+	var terminalOutput io.Writer = bufferedOutput
+	if c.watch {
+		// new lines are shown as soon as they arrive rather than when the job completes
+		terminalOutput = &flushingWriter{w: bufferedOutput}
+	}
+	colorWriter := logviewer.NewColorWriter(terminalOutput)
+	if colorOutput {
+		terminalOutput = colorWriter
+	}
+	rawCounter := &logviewer.LineCounter{}
+	outputCounter := &logviewer.LineCounter{}
+	// the lines output by each stage are counted for --verbose
+	stageNames := []string{}
+	stageCounters := []*logviewer.LineCounter{}
+	if c.verbose {
+		for i, transform := range transforms {
+			counter := &logviewer.LineCounter{}
+			stageNames = append(stageNames, transformName(transform))
+			stageCounters = append(stageCounters, counter)
+			transforms[i] = logviewer.CountLinesTransform(transform, counter)
 		}
+	}
+	assertions := newAssertionChecker(c.assertContains, c.assertNotContains)
+	err = logviewer.RunPipeline(io.TeeReader(logs, rawCounter), io.MultiWriter(terminalOutput, outputCounter, assertions), transforms...)
+	if err != nil {
+		return logviewer.DescribeTimeout("downloading the logs", err)
+	}
+	if showProgress {
+		// clear the progress line
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+	logger.Printf("read %d lines", rawCounter.Lines())
+	for i, counter := range stageCounters {
+		logger.Printf("%d lines after %s", counter.Lines(), stageNames[i])
+	}
+	if err := colorWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if c.format == "text" && !c.raw {
+		// match the trailing newline of fmt.Println, but keep raw logs byte for byte so that they can be filtered later
+		fmt.Fprintln(bufferedOutput)
+	}
+	if err := bufferedOutput.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if len(c.outputPath) > 0 {
+		if err := output.Close(); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "wrote %s to %s\n", formatByteCount(outputCounter.Bytes), c.outputPath)
+	}
 
-		for _, entry := range entries {
-			if entry.IsDir() && entry.Name() == ".git" {
-				return filepath.Join(dir, entry.Name()), nil
+	if len(c.testNames) > 0 && outputCounter.Lines() == 0 {
+		for _, testName := range c.testNames {
+			if suggestion := logviewer.SuggestTestName(testName, availableTests); len(suggestion) > 0 {
+				fmt.Fprintf(os.Stderr, "no logs found for %s, did you mean %s?\n", testName, suggestion)
 			}
 		}
+	}
 
-		dir = filepath.Dir(dir)
-		if dir == "/" {
-			return "", fmt.Errorf("did not find .git folder before reaching filesystem root")
-		}
+	if len(c.inputPath) > 0 {
+		explanation = append(explanation, fmt.Sprintf("read %s", formatByteCount(rawCounter.Bytes)))
+	} else if source.Cached {
+		explanation = append(explanation, fmt.Sprintf("read %s from the cache", formatByteCount(rawCounter.Bytes)))
+	} else {
+		explanation = append(explanation, fmt.Sprintf("downloaded %s", formatByteCount(rawCounter.Bytes)))
+	}
+	if matchesTest != nil {
+		explanation = append(explanation, fmt.Sprintf("filtered to %s leaving %d of %d lines", filterDescription, outputCounter.Lines(), rawCounter.Lines()))
+	}
+	if c.explain {
+		fmt.Fprintln(os.Stderr, capitalize(strings.Join(explanation, ", "))+".")
 	}
-}
 
-func parseSummary(logs []byte) []byte {
-	newLogs := []byte{}
-	for i := 0; i < len(logs); {
-		endOfLineIdx := findNext(logs, i, '\n')
-		line := string(logs[i : endOfLineIdx+1])
-		if strings.Contains(line, "--- PASS") || strings.Contains(line, "--- FAIL") {
-			newLogs = append(newLogs, []byte(line)...)
-		}
-		i = endOfLineIdx + 1
+	if err := assertions.err(); err != nil {
+		return err
 	}
-	return newLogs
+	if c.failOnError && failed {
+		return errTestFailure
+	}
+	return nil
 }
 
-func parseRemoteOwnerAndRepo(r *git.Repository) (string, string, error) {
-	remotes, err := r.Remotes()
+// Returns the file at the given path to write the output to, or stdout if the path is empty.
+func createOutput(path string) (*os.File, error) {
+	if len(path) == 0 {
+		return os.Stdout, nil
+	}
+	file, err := os.Create(path)
 	if err != nil {
-		return "", "", err
+		return nil, fmt.Errorf("failed to write output: %w", err)
 	}
+	return file, nil
+}
 
-	if len(remotes) == 1 {
-		urls := remotes[0].Config().URLs
-		matches := gitRegex.FindAllStringSubmatch(urls[0], -1)
-		owner := matches[0][6]
-		repo := matches[0][7]
-		return owner, repo, nil
-	} else {
-		return "", "", fmt.Errorf("can't parse owner and repo with more than one remote")
+// Returns a client which sends requests through the given proxy URL, presents the client certificate in the given certificate and key files,
+// and trusts the certificate authorities in the given CA bundle file as well as the system ones, each if it is not empty.
+// If all are empty, returns nil to use http.DefaultClient, which sends requests through the proxy given by the environment.
+func newHTTPClient(proxy string, certPath string, keyPath string, caBundlePath string) (*http.Client, error) {
+	if len(certPath) > 0 != (len(keyPath) > 0) {
+		return nil, usageError{err: errors.New("client-cert and client-key must be used together. see usage via --help")}
+	}
+	if len(proxy) == 0 && len(certPath) == 0 && len(caBundlePath) == 0 {
+		return nil, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(proxy) > 0 {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || len(proxyURL.Host) == 0 {
+			return nil, usageError{err: errors.New("proxy must be a URL such as http://proxy.example.com:3128. see usage via --help")}
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	transport.TLSClientConfig = &tls.Config{}
+	if len(certPath) > 0 {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
 	}
+	if len(caBundlePath) > 0 {
+		bundle, err := os.ReadFile(caBundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("failed to read the CA bundle: no PEM certificates found in %s", caBundlePath)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// A writer which flushes each write through to the underlying writer.
+type flushingWriter struct {
+	w *bufio.Writer
 }
 
-func parseBranch(r *git.Repository) (string, error) {
-	ref, err := r.Head()
+func (f *flushingWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
 	if err != nil {
-		return "", err
+		return n, err
 	}
-	if !ref.Name().IsBranch() {
-		return "", fmt.Errorf("can't parse branch because git HEAD is not a branch")
-	}
-	return ref.Name().Short(), nil
+	return n, f.w.Flush()
+}
+
+// Returns whether the given file is a terminal rather than a pipe or regular file.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-// Returns new logs.
-// Removes the timestamp prefix from each line of the logs.
-func removeTimestampPrefix(logs []byte) []byte {
-	newLogs := []byte{}
-	for i := 0; i < len(logs); {
-		endOfTimestampIdx := findNext(logs, i, ' ')
-		endOfLineIdx := findNext(logs, endOfTimestampIdx+1, '\n')
-		line := logs[endOfTimestampIdx+1 : endOfLineIdx+1]
-		newLogs = append(newLogs, line...)
-		i = endOfLineIdx + 1
-	}
-	return newLogs
+// Returns whether output is colorized for the given --color mode. NO_COLOR disables color unless the mode is always.
+func colorize(mode string, noColor bool, terminal bool) bool {
+	return mode == "always" || (mode == "auto" && !noColor && terminal)
 }
 
-// Returns new logs.
-// Removes the given test name from the start of each log line if it is present.
-func removeTestNamePrefix(logs []byte, testName []byte) []byte {
-	newLogs := []byte{}
-	for i := 0; i < len(logs); {
-		endOfLineIdx := findNext(logs, i, '\n')
-		if hasPrefix(logs, i, testName) {
-			endOfPrefixIdx := i + len(testName) + 1 // +1 because of a space following the test name
-			line := logs[endOfPrefixIdx : endOfLineIdx+1]
-			newLogs = append(newLogs, line...)
+// Returns a logviewer.ProgressFunc which writes the progress of a download to w, replacing the previous progress on the same line.
+// Writes at most every 100ms so the progress is readable.
+func progressPrinter(w io.Writer) logviewer.ProgressFunc {
+	var lastPrint time.Time
+	return func(downloaded int64, total int64) {
+		if time.Since(lastPrint) < 100*time.Millisecond && downloaded != total {
+			return
+		}
+		lastPrint = time.Now()
+		if total < 0 {
+			fmt.Fprintf(w, "\rdownloaded %s", formatByteCount(int(downloaded)))
 		} else {
-			line := logs[i : endOfLineIdx+1]
-			newLogs = append(newLogs, line...)
+			fmt.Fprintf(w, "\rdownloaded %s of %s", formatByteCount(int(downloaded)), formatByteCount(int(total)))
 		}
-		i = endOfLineIdx + 1
 	}
-	return newLogs
 }
 
-// Returns new logs.
-// Includes log lines which begin with the given test name.
-// Also includes lines with appear to be part of the given test, but which do not start with the given test name.
-func filterLogs(logs []byte, testName []byte) ([]byte, error) {
-	filteredLogs := []byte{}
-
-	i := 0
-	priorLineMatchedPrefix := false
-	for {
-		if i >= len(logs) {
-			break
+// Returns a human readable size for the given number of bytes, e.g. 12.3MB.
+func formatByteCount(n int) string {
+	if n < 1000 {
+		return fmt.Sprintf("%dB", n)
+	}
+	value := float64(n) / 1000
+	for _, suffix := range []string{"kB", "MB"} {
+		if value < 1000 {
+			return fmt.Sprintf("%.1f%s", value, suffix)
 		}
+		value /= 1000
+	}
+	return fmt.Sprintf("%.1fGB", value)
+}
 
-		endOfLineIdx := findNext(logs, i, '\n')
-
-		// if the line has the testName prefix, add the line to filteredLogs
-		if hasPrefix(logs, i, testName) || hasTestFailurePrefix(logs, i, testName) {
-			line := logs[i : endOfLineIdx+1]
-			filteredLogs = append(filteredLogs, line...)
-			priorLineMatchedPrefix = true
-		} else {
-			// extend the "selection" to lines that don't have the prefix if we haven't moved to a new test yet
-			// Go tests must start with "Test" so we can use this as a filter to know when we moved to a new test
-			if priorLineMatchedPrefix {
-				if hasPrefix(logs, i, []byte("Test")) {
-					priorLineMatchedPrefix = false
-				} else {
-					line := logs[i : endOfLineIdx+1]
-					filteredLogs = append(filteredLogs, line...)
-				}
-			}
-		}
+// Returns the name of the function which created the given transform, e.g. FilterLogsTransform.
+func transformName(transform logviewer.Transform) string {
+	name := runtime.FuncForPC(reflect.ValueOf(transform).Pointer()).Name()
+	// the transform is a closure such as github.com/Octogonapus/TerratestLogViewer/pkg/logviewer.FilterLogsTransform.func1
+	name = name[strings.LastIndex(name, "/")+1:]
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 {
+		return name
+	}
+	return parts[1]
+}
 
-		i = endOfLineIdx + 1 // advance to next line
+// Returns the given string with its first letter in upper case.
+func capitalize(s string) string {
+	if len(s) == 0 {
+		return s
 	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
 
-	return filteredLogs, nil
+// An io.Writer which records whether the given pattern was written to it, even when the pattern is split across writes.
+type containsWriter struct {
+	pattern []byte
+	window  []byte
+	found   bool
 }
 
-// Returns whether the given string, starting at the given offset, equals the given prefix for the length of the given prefix.
-func hasPrefix(str []byte, offset int, prefix []byte) bool {
-	for i := 0; i < len(prefix); i++ {
-		if offset+i >= len(str) || str[offset+i] != prefix[i] {
-			return false
-		}
+func (c *containsWriter) Write(p []byte) (int, error) {
+	if c.found || len(c.pattern) == 0 {
+		return len(p), nil
 	}
-	return true
-}
 
-var testFailurePrefix = []byte("=== NAME  ")
+	c.window = append(c.window, p...)
+	if bytes.Contains(c.window, c.pattern) {
+		c.found = true
+		c.window = nil
+	} else if keep := len(c.pattern) - 1; len(c.window) > keep {
+		// only a suffix shorter than the pattern could be the start of a match in a later write
+		c.window = append(c.window[:0], c.window[len(c.window)-keep:]...)
+	}
+	return len(p), nil
+}
 
-// Returns whether the given string, starting at the given offset, has a prefix which indicates a test failure for a test with the given name
-func hasTestFailurePrefix(str []byte, offset int, testName []byte) bool {
-	hasFailurePrefix := hasPrefix(str, offset, testFailurePrefix)
-	hasTestName := hasPrefix(str, offset+len(testFailurePrefix), testName)
-	return hasFailurePrefix && hasTestName
+// An io.Writer which checks assertions about the content written to it.
+type assertionChecker struct {
+	contains    containsWriter
+	notContains containsWriter
 }
 
-// Returns the next index of the next given character in the given string, or the last index of the given string.
-func findNext(str []byte, offset int, test byte) int {
-	for i := offset; i < len(str); i++ {
-		if str[i] == test {
-			return i
-		}
+// Returns an assertionChecker for the given assertions. Empty assertions are ignored.
+func newAssertionChecker(contains string, notContains string) *assertionChecker {
+	return &assertionChecker{
+		contains:    containsWriter{pattern: []byte(contains)},
+		notContains: containsWriter{pattern: []byte(notContains)},
 	}
-	return len(str) - 1
 }
 
-// Returns the content of the log for the most recent job matching the given parameters.
-func getLogs(gh *github.Client, owner string, repo string, workflowFilename string, branch string, jobName string) ([]byte, error) {
-	runs, _, err := gh.Actions.ListWorkflowRunsByFileName(context.Background(), owner, repo, workflowFilename, &github.ListWorkflowRunsOptions{Branch: branch})
-	if err != nil {
-		return nil, err
+func (a *assertionChecker) Write(p []byte) (int, error) {
+	a.contains.Write(p)
+	a.notContains.Write(p)
+	return len(p), nil
+}
+
+// Returns an error describing the first assertion which does not hold for the content written so far.
+func (a *assertionChecker) err() error {
+	if len(a.contains.pattern) > 0 && !a.contains.found {
+		return fmt.Errorf("assertion failed: logs do not contain %q", a.contains.pattern)
+	}
+	if len(a.notContains.pattern) > 0 && a.notContains.found {
+		return fmt.Errorf("assertion failed: logs contain %q", a.notContains.pattern)
 	}
+	return nil
+}
 
-	latestRunID := runs.WorkflowRuns[0].ID
+// A list of test names which can be given as a repeated and/or comma-separated flag.
+type testNameList []string
 
-	jobs, _, err := gh.Actions.ListWorkflowJobs(context.Background(), owner, repo, *latestRunID, &github.ListWorkflowJobsOptions{})
-	if err != nil {
-		return nil, err
-	}
+func (l *testNameList) String() string {
+	return strings.Join(*l, ",")
+}
 
-	jobID := int64(-1)
-	for _, job := range jobs.Jobs {
-		if *job.Name == jobName {
-			jobID = *job.ID
-			break
+func (l *testNameList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if len(name) > 0 {
+			*l = append(*l, name)
 		}
 	}
-	if jobID == -1 {
-		return nil, fmt.Errorf("did not find matching job")
-	}
+	return nil
+}
 
-	_, logsGHResp, err := gh.Actions.GetWorkflowJobLogs(context.Background(), owner, repo, jobID, false)
-	if err != nil {
-		return nil, err
+func (l testNameList) bytes() [][]byte {
+	names := make([][]byte, len(l))
+	for i, name := range l {
+		names[i] = []byte(name)
 	}
+	return names
+}
 
-	logsResp, err := http.Get(logsGHResp.Header.Get("Location"))
-	if err != nil {
-		return nil, err
-	}
-	defer logsResp.Body.Close()
+// A flag which may be repeated to give several values. Unlike testNameList, values are not split on commas, as they may be regular expressions.
+type patternList []string
 
-	logsBody, err := io.ReadAll(logsResp.Body)
-	if err != nil {
-		return nil, err
-	}
+func (l *patternList) String() string {
+	return strings.Join(*l, " ")
+}
 
-	return logsBody, nil
+func (l *patternList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
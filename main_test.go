@@ -1,181 +1,489 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/go-git/go-git/v5"
 	"github.com/google/go-github/v52/github"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/oauth2"
+
+	"github.com/Octogonapus/TerratestLogViewer/pkg/logviewer"
 )
 
-// basic test to check it does not crash. hard to test much else
-func TestGetLogs(t *testing.T) {
+func TestTestNameListSet(t *testing.T) {
 	t.Parallel()
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")})
-	tc := oauth2.NewClient(ctx, ts)
-	gh := github.NewClient(tc)
-	logs, err := getLogs(gh, "Octogonapus", "TerratestLogViewer", "test.yml", "main", "test")
-	assert.NotEmpty(t, logs)
-	assert.NoError(t, err)
+	names := testNameList{}
+	assert.NoError(t, names.Set("TestA,TestB"))
+	assert.NoError(t, names.Set("TestC"))
+	assert.Equal(t, testNameList{"TestA", "TestB", "TestC"}, names)
+	assert.Equal(t, "TestA,TestB,TestC", names.String())
 }
 
-func TestFilterLogs1(t *testing.T) {
+func TestCheckAssertions(t *testing.T) {
 	t.Parallel()
-	logs := "TestA 1\nTestB 1\nTestA 2\nTestB 2\n"
-	testName := "TestA"
-	filteredLogs, err := filterLogs([]byte(logs), []byte(testName))
-	assert.NoError(t, err)
-	assert.Equal(t, "TestA 1\nTestA 2\n", string(filteredLogs))
+	checkAssertions := func(contains string, notContains string) error {
+		assertions := newAssertionChecker(contains, notContains)
+		// split the logs across writes to check patterns which span them are still found
+		assertions.Write([]byte("TestFoo 1\nApply com"))
+		assertions.Write([]byte("plete!\n"))
+		return assertions.err()
+	}
+	assert.NoError(t, checkAssertions("", ""))
+	assert.NoError(t, checkAssertions("Apply complete!", "Error:"))
+	assert.EqualError(t, checkAssertions("Destroy complete!", ""), `assertion failed: logs do not contain "Destroy complete!"`)
+	assert.EqualError(t, checkAssertions("", "TestFoo"), `assertion failed: logs contain "TestFoo"`)
 }
 
-func TestFilterLogs2(t *testing.T) {
+func TestFormatByteCount(t *testing.T) {
 	t.Parallel()
-	logs := "TestA 1\nTestB 1\nTestA 2\nTestB 2\n"
-	testName := "TestB"
-	filteredLogs, err := filterLogs([]byte(logs), []byte(testName))
-	assert.NoError(t, err)
-	assert.Equal(t, "TestB 1\nTestB 2\n", string(filteredLogs))
+	assert.Equal(t, "999B", formatByteCount(999))
+	assert.Equal(t, "1.5kB", formatByteCount(1500))
+	assert.Equal(t, "12.3MB", formatByteCount(12_300_000))
 }
 
-func TestFilterLogsNoNewlineAtEnd(t *testing.T) {
+func TestColorize(t *testing.T) {
 	t.Parallel()
-	logs := "TestA 1\nTestB 1\nTestA 2\nTestB 2"
-	testName := "TestB"
-	filteredLogs, err := filterLogs([]byte(logs), []byte(testName))
+	assert.True(t, colorize("auto", false, true))
+	assert.False(t, colorize("auto", false, false))
+	assert.False(t, colorize("auto", true, true))
+	assert.True(t, colorize("always", true, false))
+	assert.False(t, colorize("never", false, true))
+}
+
+func TestParseConfigNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	c, err := parseConfig([]string{}, "")
+	assert.NoError(t, err)
+	assert.True(t, c.noColor)
+
+	t.Setenv("NO_COLOR", "")
+	c, err = parseConfig([]string{}, "")
 	assert.NoError(t, err)
-	assert.Equal(t, "TestB 1\nTestB 2", string(filteredLogs))
+	assert.False(t, c.noColor)
 }
 
-// when a line has no prefix, it should be included if the line before it has the desired prefix, or if the line
-// before it recursively matches this condition
-func TestFilterLogsNoPrefixContinuation1(t *testing.T) {
+func TestProgressPrinter(t *testing.T) {
 	t.Parallel()
-	logs := "TestA 1\nno prefix\nTestB 1\n"
-	testName := "TestA"
-	filteredLogs, err := filterLogs([]byte(logs), []byte(testName))
-	assert.NoError(t, err)
-	assert.Equal(t, "TestA 1\nno prefix\n", string(filteredLogs))
+	output := &bytes.Buffer{}
+	printProgress := progressPrinter(output)
+	printProgress(1500, 3000)
+	// too soon after the previous progress to be written
+	printProgress(2000, 3000)
+	printProgress(3000, 3000)
+	assert.Equal(t, "\rdownloaded 1.5kB of 3.0kB\rdownloaded 3.0kB of 3.0kB", output.String())
+
+	output.Reset()
+	progressPrinter(output)(999, -1)
+	assert.Equal(t, "\rdownloaded 999B", output.String())
 }
 
-func TestFilterLogsNoPrefixContinuation2(t *testing.T) {
+func TestNewHTTPClient(t *testing.T) {
 	t.Parallel()
-	logs := "TestA 1\nno prefix 1\nTestA 2\nTestB 1\nno prefix 2\n"
-	testName := "TestA"
-	filteredLogs, err := filterLogs([]byte(logs), []byte(testName))
+	client, err := newHTTPClient("", "", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, client)
+
+	client, err = newHTTPClient("http://proxy.example.com:3128", "", "", "")
+	assert.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com", nil)
+	assert.NoError(t, err)
+	proxyURL, err := client.Transport.(*http.Transport).Proxy(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+
+	_, err = newHTTPClient("proxy.example.com", "", "", "")
+	assert.EqualError(t, err, "proxy must be a URL such as http://proxy.example.com:3128. see usage via --help")
+}
+
+// Writes a self-signed PEM certificate and its PEM private key to files in the given directory, and returns their paths.
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test"}, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
 	assert.NoError(t, err)
-	assert.Equal(t, "TestA 1\nno prefix 1\nTestA 2\n", string(filteredLogs))
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	assert.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certPath, keyPath
 }
 
-func TestFilterLogsNoPrefixContinuation3(t *testing.T) {
+func TestNewHTTPClientWithTLS(t *testing.T) {
 	t.Parallel()
-	logs := "TestA 1\nno prefix 1\nTestA 2\nTestB 1\nno prefix 2\n"
-	testName := "TestB"
-	filteredLogs, err := filterLogs([]byte(logs), []byte(testName))
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCertificate(t, dir)
+
+	client, err := newHTTPClient("", certPath, keyPath, certPath)
 	assert.NoError(t, err)
-	assert.Equal(t, "TestB 1\nno prefix 2\n", string(filteredLogs))
+	tlsConfig := client.Transport.(*http.Transport).TLSClientConfig
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.NotNil(t, tlsConfig.RootCAs)
+
+	_, err = newHTTPClient("", certPath, "", "")
+	assert.EqualError(t, err, "client-cert and client-key must be used together. see usage via --help")
+	_, err = newHTTPClient("", certPath, certPath, "")
+	assert.ErrorContains(t, err, "failed to load the client certificate")
+	_, err = newHTTPClient("", "", "", keyPath)
+	assert.EqualError(t, err, "failed to read the CA bundle: no PEM certificates found in "+keyPath)
+	_, err = newHTTPClient("", "", "", filepath.Join(dir, "missing.pem"))
+	assert.ErrorContains(t, err, "failed to read the CA bundle")
 }
 
-func TestFilterLogsNoMatchingLines(t *testing.T) {
+func TestNewHTTPClientWithEnterpriseServer(t *testing.T) {
 	t.Parallel()
-	logs := "TestB 1\nno prefix\n"
-	testName := "TestA"
-	filteredLogs, err := filterLogs([]byte(logs), []byte(testName))
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCertificate(t, dir)
+	clientCert, err := os.ReadFile(certPath)
+	assert.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	assert.True(t, clientCAs.AppendCertsFromPEM(clientCert))
+
+	// an Enterprise installation behind mutual TLS serves its API under /api/v3/
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/repos/MyOrg/MyRepo" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"name": "MyRepo"}`)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	caBundlePath := filepath.Join(dir, "server.pem")
+	assert.NoError(t, os.WriteFile(caBundlePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o644))
+
+	httpClient, err := newHTTPClient("", certPath, keyPath, caBundlePath)
+	assert.NoError(t, err)
+	gh, err := logviewer.NewGitHubClient(context.Background(), nil, "", false, httpClient, server.URL)
 	assert.NoError(t, err)
-	assert.Equal(t, "", string(filteredLogs))
+	repo, _, err := gh.Repositories.Get(context.Background(), "MyOrg", "MyRepo")
+	assert.NoError(t, err)
+	assert.Equal(t, "MyRepo", repo.GetName())
+
+	// the server rejects a client without the certificate
+	httpClient, err = newHTTPClient("", "", "", caBundlePath)
+	assert.NoError(t, err)
+	gh, err = logviewer.NewGitHubClient(context.Background(), nil, "", false, httpClient, server.URL)
+	assert.NoError(t, err)
+	_, _, err = gh.Repositories.Get(context.Background(), "MyOrg", "MyRepo")
+	assert.Error(t, err)
 }
 
-func TestRemoveTimestampPrefix1(t *testing.T) {
+func TestCreateOutputFile(t *testing.T) {
 	t.Parallel()
-	logs := []byte("2023-05-02T19:31:15.2539162Z Done in 219ms.")
-	actual := removeTimestampPrefix(logs)
-	assert.Equal(t, "Done in 219ms.", string(actual))
+	path := filepath.Join(t.TempDir(), "logs.txt")
+	output, err := createOutput(path)
+	assert.NoError(t, err)
+	_, err = output.Write([]byte("TestFoo 1\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, output.Close())
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestFoo 1\n", string(content))
 }
 
-func TestRemoveTestNamePrefix(t *testing.T) {
+func TestCreateOutputInMissingDirectory(t *testing.T) {
 	t.Parallel()
-	logs := []byte("TestFoo 1\nno prefix 2\nTestFoo 3\nno prefix 4\n")
-	actual := removeTestNamePrefix(logs, []byte("TestFoo"))
-	assert.Equal(t, "1\nno prefix 2\n3\nno prefix 4\n", string(actual))
+	_, err := createOutput(filepath.Join(t.TempDir(), "missing", "logs.txt"))
+	assert.ErrorContains(t, err, "failed to write output")
 }
 
-// A test's failure should be included when filtering for a specific test, even when another test's output precedes it
-func TestTestFailureIncluded(t *testing.T) {
+func TestParseConfig(t *testing.T) {
 	t.Parallel()
-	logs := []byte("TestFoo 1\nTestBar 1\n=== NAME  TestFoo\n    foo.go:123:\n") // a real example would have many more lines without a prefix but this should be enough
-	testName := "TestFoo"
-	actual, err := filterLogs([]byte(logs), []byte(testName))
+	c, err := parseConfig([]string{"--owner", "MyOrg", "--test", "TestA,TestB", "--remove-prefix=false", "--strip-ansi"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "MyOrg", c.owner)
+	assert.Equal(t, testNameList{"TestA", "TestB"}, c.testNames)
+	assert.False(t, c.removePrefix)
+	assert.True(t, c.stripANSI)
+	assert.Equal(t, "text", c.format)
+	assert.True(t, c.setFlags["owner"])
+	assert.False(t, c.setFlags["format"])
+
+	c, err = parseConfig([]string{"--errors-only"}, "")
 	assert.NoError(t, err)
-	assert.Equal(t, "TestFoo 1\n=== NAME  TestFoo\n    foo.go:123:\n", string(actual))
+	assert.True(t, c.onlyTerraformErrors)
+
+	_, err = parseConfig([]string{"--not-a-flag"}, "")
+	assert.Error(t, err)
 }
 
-func TestHasTestFailurePrefix(t *testing.T) {
+func TestParseConfigFile(t *testing.T) {
 	t.Parallel()
-	logs := []byte("=== NAME  TestFoo\n")
-	testName := "TestFoo"
-	actual := hasTestFailurePrefix(logs, 0, []byte(testName))
-	assert.True(t, actual)
+	path := filepath.Join(t.TempDir(), configFileName)
+	assert.NoError(t, os.WriteFile(path, []byte("owner: MyOrg\nworkflow: test.yml\ntest: [TestA, TestB]\nremove-prefix: false\n"), 0o644))
+
+	c, err := parseConfig([]string{"--workflow", "other.yml"}, path)
+	assert.NoError(t, err)
+	assert.Equal(t, "MyOrg", c.owner)
+	// flags override the file
+	assert.Equal(t, "other.yml", c.workflowFilename)
+	assert.Equal(t, testNameList{"TestA", "TestB"}, c.testNames)
+	assert.False(t, c.removePrefix)
+	assert.True(t, c.setFlags["owner"])
+
+	_, err = parseConfig([]string{}, filepath.Join(t.TempDir(), configFileName))
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(path, []byte("not-a-flag: 1\n"), 0o644))
+	_, err = parseConfig([]string{}, path)
+	assert.EqualError(t, err, "failed to parse "+path+": unknown flag not-a-flag")
+
+	assert.NoError(t, os.WriteFile(path, []byte("timeout: soon\n"), 0o644))
+	_, err = parseConfig([]string{}, path)
+	assert.ErrorContains(t, err, "failed to parse "+path+": invalid value for timeout")
 }
 
-func TestParseSummary(t *testing.T) {
+func TestTransformName(t *testing.T) {
 	t.Parallel()
-	logs := "--- PASS: TestAll (2788.26s)\nksjdfks\n--- FAIL: Bar"
-	actual := parseSummary([]byte(logs))
-	assert.Equal(t, "--- PASS: TestAll (2788.26s)\n--- FAIL: Bar", string(actual))
+	assert.Equal(t, "FilterLogsTransform", transformName(logviewer.FilterLogsTransform(nil)))
+	assert.Equal(t, "StripANSITransform", transformName(logviewer.StripANSITransform()))
 }
 
-func TestParseSummaryForSubtests(t *testing.T) {
+func TestRun(t *testing.T) {
 	t.Parallel()
-	logs := "--- PASS: TestAll (2788.26s)\n    --- FAIL: TestAll/foo (10.11s)\n    --- PASS: TestAll/bar (10.12s)"
-	actual := parseSummary([]byte(logs))
-	assert.Equal(t, logs, string(actual))
+	logs := "2023-05-02T19:31:15Z TestA 1\n2023-05-02T19:31:15Z TestB 1\n2023-05-02T19:31:16Z --- FAIL: TestA (1.00s)\n"
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{name: "all logs", args: []string{}, want: "TestA 1\nTestB 1\n--- FAIL: TestA (1.00s)\n\n"},
+		{name: "one test", args: []string{"--test", "TestA"}, want: "1\n--- FAIL: TestA (1.00s)\n\n"},
+		{name: "several tests keeping prefix", args: []string{"--test", "TestA,TestB", "--remove-prefix=false"}, want: "TestA 1\nTestB 1\n--- FAIL: TestA (1.00s)\n\n"},
+		{name: "json keeping prefix", args: []string{"--test", "TestA", "--format", "json", "--remove-prefix=false"}, want: `{"test":"TestA","timestamp":"2023-05-02T19:31:15Z","message":"TestA 1","raw_line":1}` + "\n" + `{"test":"TestA","timestamp":"2023-05-02T19:31:16Z","message":"--- FAIL: TestA (1.00s)","raw_line":3}` + "\n"},
+		{name: "json filtered", args: []string{"--format", "json", "--filter", `message contains "FAIL"`}, want: `{"test":"TestA","timestamp":"2023-05-02T19:31:16Z","message":"--- FAIL: TestA (1.00s)","raw_line":3}` + "\n"},
+		{name: "summary", args: []string{"--summary"}, want: "--- FAIL: TestA (1.00s)\n\n"},
+		{name: "flaky", args: []string{"--flaky"}, want: "\n"},
+		{name: "count", args: []string{"--count", "--test", "TestA"}, want: "lines\t3\nmatching lines\t2\npassed\t0\nfailed\t1\nskipped\t0\n\n"},
+		{name: "filter", args: []string{"--filter", `test == "TestA" && message contains "FAIL"`}, want: "--- FAIL: TestA (1.00s)\n\n"},
+		{name: "invalid filter", args: []string{"--filter", `test = "TestA"`}, wantErr: "invalid filter: unexpected '=' at offset 5"},
+		{name: "anchor lines", args: []string{"--after-line", "TestA 1", "--before-line", "FAIL"}, want: "TestA 1\nTestB 1\n--- FAIL: TestA (1.00s)\n\n"},
+		{name: "anchor lines excluded", args: []string{"--after-line", "TestA 1", "--before-line", "FAIL", "--exclude-anchors"}, want: "TestB 1\n\n"},
+		{name: "exclude anchors without anchor", args: []string{"--exclude-anchors"}, wantErr: "exclude-anchors requires after-line or before-line. see usage via --help"},
+		{name: "redact pattern", args: []string{"--redact-pattern", `TestB (\d)`}, want: "TestA 1\nTestB ***REDACTED***\n--- FAIL: TestA (1.00s)\n\n"},
+		{name: "invalid redact pattern", args: []string{"--redact-pattern", "("}, wantErr: "failed to compile redact-pattern: error parsing regexp: missing closing ): `(`"},
+		{name: "fail on error", args: []string{"--fail-on-error"}, want: "TestA 1\nTestB 1\n--- FAIL: TestA (1.00s)\n\n", wantErr: "logs contain a test failure"},
+		{name: "verbose", args: []string{"--verbose", "--test", "TestA"}, want: "1\n--- FAIL: TestA (1.00s)\n\n"},
+		{name: "invalid status", args: []string{"--status", "done"}, wantErr: "status must be one of completed, in_progress, queued, or any. see usage via --help"},
+		{name: "invalid conclusion", args: []string{"--conclusion", "failed"}, wantErr: "conclusion must be one of failure, success, or cancelled. see usage via --help"},
+		{name: "max runs without test", args: []string{"--max-runs", "5"}, wantErr: "max-runs requires test or regex. see usage via --help"},
+		{name: "empty test prefix", args: []string{"--test-prefix", ""}, wantErr: "test-prefix must not be empty. see usage via --help"},
+		{name: "split by test without output dir", args: []string{"--split-by-test"}, wantErr: "split-by-test and output-dir must be used together. see usage via --help"},
+		{name: "wait for run input", args: []string{"--wait-for-run", "1m"}, wantErr: "wait-for-run and input cannot be used together. see usage via --help"},
+		{name: "search org input", args: []string{"--search-org", "--owner", "MyOrg", "--workflow", "test.yml", "--test", "TestA"}, wantErr: "search-org and input cannot be used together. see usage via --help"},
+		{name: "whole run input", args: []string{"--whole-run"}, wantErr: "whole-run and input cannot be used together. see usage via --help"},
+		{name: "watch input", args: []string{"--watch"}, wantErr: "watch and input cannot be used together. see usage via --help"},
+		{name: "invalid format", args: []string{"--format", "xml"}, wantErr: "format must be one of text, json, junit, or markdown. see usage via --help"},
+		{name: "assert contains", args: []string{"--test", "TestA", "--assert-contains", "TestB"}, want: "1\n--- FAIL: TestA (1.00s)\n\n", wantErr: `assertion failed: logs do not contain "TestB"`},
+		{name: "assert with summary", args: []string{"--summary", "--assert-contains", "TestB"}, wantErr: "assert-contains and assert-not-contains only check text output, so they cannot be used together with summary, list-tests, flaky, count, split-by-test, or another format. see usage via --help"},
+		{name: "assert with json", args: []string{"--format", "json", "--assert-not-contains", "TestA"}, wantErr: "assert-contains and assert-not-contains only check text output, so they cannot be used together with summary, list-tests, flaky, count, split-by-test, or another format. see usage via --help"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			input := filepath.Join(dir, "input.log")
+			output := filepath.Join(dir, "output.log")
+			assert.NoError(t, os.WriteFile(input, []byte(logs), 0o644))
+
+			c, err := parseConfig(append([]string{"--input", input, "--output", output, "--echo-config=false", "--no-cache"}, test.args...), "")
+			assert.NoError(t, err)
+			err = run(c)
+			if len(test.wantErr) > 0 {
+				assert.EqualError(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			if len(test.want) > 0 {
+				actual, err := os.ReadFile(output)
+				assert.NoError(t, err)
+				assert.Equal(t, test.want, string(actual))
+			}
+		})
+	}
 }
 
-func TestParseRemoteOwnerAndRepo(t *testing.T) {
+func TestRunHeadWithLateFailure(t *testing.T) {
 	t.Parallel()
 	dir := t.TempDir()
+	input := filepath.Join(dir, "input.log")
+	output := filepath.Join(dir, "output.log")
+	logs := strings.Repeat("2023-05-02T19:31:15Z TestA 1\n", 5000) + "2023-05-02T19:31:16Z --- FAIL: TestA (1.00s)\n"
+	assert.NoError(t, os.WriteFile(input, []byte(logs), 0o644))
 
-	cmd := exec.Command("git", "init", ".")
-	cmd.Dir = dir
-	assert.NoError(t, cmd.Run())
+	c, err := parseConfig([]string{"--input", input, "--output", output, "--echo-config=false", "--no-cache", "--head", "1", "--fail-on-error"}, "")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, run(c), errTestFailure)
+	actual, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestA 1\n\n", string(actual))
+}
 
-	cmd = exec.Command("git", "remote", "add", "origin", "https://github.com/Octogonapus/TerratestLogViewer.git")
-	cmd.Dir = dir
-	assert.NoError(t, cmd.Run())
+func TestRunErrorsOnly(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.log")
+	output := filepath.Join(dir, "output.log")
+	logs := "2023-05-02T19:31:15Z TestA 1\n2023-05-02T19:31:15Z TestA Error: bad thing\n2023-05-02T19:31:15Z   on main.tf line 1\n2023-05-02T19:31:16Z TestA 2\n"
+	assert.NoError(t, os.WriteFile(input, []byte(logs), 0o644))
 
-	r, err := git.PlainOpen(dir)
+	c, err := parseConfig([]string{"--input", input, "--output", output, "--echo-config=false", "--no-cache", "--errors-only"}, "")
 	assert.NoError(t, err)
-
-	owner, repo, err := parseRemoteOwnerAndRepo(r)
+	assert.NoError(t, run(c))
+	actual, err := os.ReadFile(output)
 	assert.NoError(t, err)
-	assert.Equal(t, "Octogonapus", owner)
-	assert.Equal(t, "TerratestLogViewer", repo)
+	assert.Equal(t, "TestA Error: bad thing\nTestA   on main.tf line 1\n\n", string(actual))
 }
 
-func TestParseBranch(t *testing.T) {
+func TestExitCode(t *testing.T) {
 	t.Parallel()
 	dir := t.TempDir()
+	input := filepath.Join(dir, "input.log")
+	assert.NoError(t, os.WriteFile(input, []byte("2023-05-02T19:31:16Z --- FAIL: TestA (1.00s)\n"), 0o644))
+	runErr := func(args ...string) error {
+		c, err := parseConfig(append([]string{"--input", input, "--output", filepath.Join(dir, "output.log"), "--echo-config=false", "--no-cache"}, args...), "")
+		assert.NoError(t, err)
+		return run(c)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "test failure", err: runErr("--fail-on-error"), want: exitFailure},
+		{name: "invalid argument", err: runErr("--format", "xml"), want: exitUsage},
+		{name: "invalid regex", err: runErr("--regex", "("), want: exitUsage},
+		{name: "invalid filter", err: runErr("--filter", `test = "TestA"`), want: exitUsage},
+		{name: "invalid since", err: runErr("--since", "yesterday"), want: exitUsage},
+		{name: "invalid combination", err: runErr("--exclude-anchors"), want: exitUsage},
+		{name: "invalid job pattern", err: runErr("--job", "test ["), want: exitUsage},
+		{name: "incomplete app credentials", err: fmt.Errorf("failed to authenticate: %w", logviewer.ErrIncompleteAppCredentials), want: exitUsage},
+		{name: "no runs", err: fmt.Errorf("failed to find run: %w", logviewer.ErrNoRuns), want: exitNoRuns},
+		{name: "job not found", err: fmt.Errorf("did not find matching job: %w", logviewer.ErrJobNotFound), want: exitJobNotFound},
+		// the error of expired logs is also an API error, but the job is what the user has to change
+		{name: "logs expired", err: fmt.Errorf("logs for run #7 have expired (older than the retention period): %w: %w", logviewer.ErrLogsExpired, &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusGone, Request: &http.Request{}}}), want: exitJobNotFound},
+		{name: "download", err: fmt.Errorf("failed to download logs: %w", logviewer.ErrDownload), want: exitNetwork},
+		{name: "api", err: fmt.Errorf("failed to list runs: %w", &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway, Request: &http.Request{}}}), want: exitNetwork},
+		{name: "connection", err: &url.Error{Op: "Get", URL: "https://api.github.com", Err: errors.New("connection refused")}, want: exitNetwork},
+		{name: "timeout", err: logviewer.DescribeTimeout("listing runs", context.DeadlineExceeded), want: exitNetwork},
+		{name: "other", err: errors.New("failed to create output file"), want: exitFailure},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Error(t, test.err)
+			assert.Equal(t, test.want, exitCode(test.err))
+		})
+	}
+}
+
+func TestParseConfigSubcommands(t *testing.T) {
+	t.Parallel()
+	c, err := parseConfig([]string{"filter", "--test", "TestA", "test.log"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "test.log", c.inputPath)
+	assert.Equal(t, testNameList{"TestA"}, c.testNames)
+	assert.False(t, c.echoConfig)
 
-	cmd := exec.Command("git", "init", ".")
-	cmd.Dir = dir
-	assert.NoError(t, cmd.Run())
+	c, err = parseConfig([]string{"filter"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "-", c.inputPath)
 
-	cmd = exec.Command("git", "checkout", "-b", "myBranchName")
-	cmd.Dir = dir
-	assert.NoError(t, cmd.Run())
+	c, err = parseConfig([]string{"fetch"}, "")
+	assert.NoError(t, err)
+	assert.True(t, c.raw)
+	assert.Equal(t, "never", c.color)
 
-	cmd = exec.Command("git", "commit", "--allow-empty", "-m", "msg")
-	cmd.Dir = dir
-	assert.NoError(t, cmd.Run())
+	c, err = parseConfig([]string{"summary", "--echo-config"}, "")
+	assert.NoError(t, err)
+	assert.True(t, c.summary)
+	assert.True(t, c.echoConfig)
 
-	r, err := git.PlainOpen(dir)
+	c, err = parseConfig([]string{"list-tests"}, "")
 	assert.NoError(t, err)
+	assert.True(t, c.listTests)
 
-	branch, err := parseBranch(r)
+	// without a subcommand, everything is done in one step as before
+	c, err = parseConfig([]string{"--test", "TestA"}, "")
 	assert.NoError(t, err)
-	assert.Equal(t, "myBranchName", branch)
+	assert.Empty(t, c.subcommand)
+	assert.True(t, c.echoConfig)
+
+	_, err = parseConfig([]string{"fetch", "--test", "TestA"}, "")
+	assert.EqualError(t, err, "fetch outputs every line of the logs, filter them with the filter subcommand instead. see usage via --help")
+	_, err = parseConfig([]string{"fetch", "--format", "json"}, "")
+	assert.EqualError(t, err, "fetch outputs the logs as they are, format them with the filter subcommand instead. see usage via --help")
+	_, err = parseConfig([]string{"filter", "a.log", "b.log"}, "")
+	assert.EqualError(t, err, "unexpected argument b.log. see usage via --help")
+	_, err = parseConfig([]string{"list-jobs", "run"}, "")
+	assert.EqualError(t, err, "unexpected argument run. see usage via --help")
+	_, err = parseConfig([]string{"fecth", "--test", "TestA"}, "")
+	assert.EqualError(t, err, "unknown subcommand fecth. see usage via --help")
+}
+
+func TestRunFetchThenFilter(t *testing.T) {
+	t.Parallel()
+	logs := "2023-05-02T19:31:15Z TestA 1\n\x1b[31m2023-05-02T19:31:15Z TestB 1\x1b[0m\n2023-05-02T19:31:16Z --- FAIL: TestA (1.00s)\n"
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.log")
+	fetched := filepath.Join(dir, "fetched.log")
+	filtered := filepath.Join(dir, "filtered.log")
+	assert.NoError(t, os.WriteFile(input, []byte(logs), 0o644))
+
+	// fetch outputs the logs as they were read
+	c, err := parseConfig([]string{"fetch", "--input", input, "--output", fetched, "--no-cache"}, "")
+	assert.NoError(t, err)
+	assert.NoError(t, run(c))
+	actual, err := os.ReadFile(fetched)
+	assert.NoError(t, err)
+	assert.Equal(t, logs, string(actual))
+
+	c, err = parseConfig([]string{"filter", "--test", "TestA", "--output", filtered, "--no-cache", fetched}, "")
+	assert.NoError(t, err)
+	assert.NoError(t, run(c))
+	actual, err = os.ReadFile(filtered)
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n--- FAIL: TestA (1.00s)\n\n", string(actual))
+}
+
+func TestWriteCompletionScript(t *testing.T) {
+	t.Parallel()
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		output := &bytes.Buffer{}
+		assert.NoError(t, writeCompletionScript(output, shell))
+		assert.Contains(t, output.String(), "workflow")
+		assert.Contains(t, output.String(), "TerratestLogViewer --list-jobs")
+		for _, command := range []string{"fetch", "filter", "summary", "list-jobs", "list-tests"} {
+			assert.Contains(t, output.String(), command)
+		}
+	}
+	assert.EqualError(t, writeCompletionScript(io.Discard, "powershell"), "completion shell must be one of bash, zsh, or fish. see usage via --help")
 }
@@ -0,0 +1,225 @@
+package logviewer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v52/github"
+	"golang.org/x/oauth2"
+)
+
+// The credentials of a GitHub App installation, used instead of a token by pipelines which authenticate as a GitHub App.
+type AppCredentials struct {
+	appID          int64
+	installationID int64
+	privateKey     *rsa.PrivateKey
+}
+
+// ErrIncompleteAppCredentials is wrapped by the error of LoadAppCredentials when an app ID is given without the rest of the credentials.
+var ErrIncompleteAppCredentials = errors.New("incomplete GitHub App credentials")
+
+// Returns the GitHub App credentials given by the flags, falling back to the GITHUB_APP_ID, GITHUB_APP_INSTALLATION_ID,
+// and GITHUB_APP_PRIVATE_KEY_PATH environment variables. Returns nil if no app ID is given.
+// Returns an error wrapping ErrIncompleteAppCredentials if the app ID is given without the installation ID or private key.
+func LoadAppCredentials(appID int64, installationID int64, privateKeyPath string) (*AppCredentials, error) {
+	var err error
+	if appID == 0 {
+		if appID, err = int64FromEnv("GITHUB_APP_ID"); err != nil {
+			return nil, err
+		}
+	}
+	if appID == 0 {
+		return nil, nil
+	}
+	if installationID == 0 {
+		if installationID, err = int64FromEnv("GITHUB_APP_INSTALLATION_ID"); err != nil {
+			return nil, err
+		}
+	}
+	if len(privateKeyPath) == 0 {
+		privateKeyPath = os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH")
+	}
+	if installationID == 0 || len(privateKeyPath) == 0 {
+		return nil, kindError{kind: ErrIncompleteAppCredentials, err: errors.New("app-id requires app-installation-id and app-private-key. see usage via --help")}
+	}
+
+	privateKeyPEM, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app private key: %w", err)
+	}
+	privateKey, err := parsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &AppCredentials{appID: appID, installationID: installationID, privateKey: privateKey}, nil
+}
+
+// Returns the integer in the given environment variable, or zero if it is not set.
+func int64FromEnv(name string) (int64, error) {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return n, nil
+}
+
+// Returns the RSA private key in the given PEM data, in either the PKCS #1 format GitHub generates or PKCS #8.
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to parse app private key: no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("failed to parse app private key: not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// Returns a JSON Web Token which authenticates as the given GitHub App.
+func appJWT(appID int64, privateKey *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	// the issued time is backdated to allow for clock drift, and GitHub rejects tokens which expire more than 10 minutes out
+	claims, err := json.Marshal(map[string]int64{"iat": now.Add(-time.Minute).Unix(), "exp": now.Add(9 * time.Minute).Unix(), "iss": appID})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app token: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Returns an installation access token for the given GitHub App installation, requested using the given client
+// which must authenticate as the app.
+func installationToken(ctx context.Context, appClient *github.Client, installationID int64) (string, error) {
+	token, _, err := appClient.Apps.CreateInstallationToken(ctx, installationID, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create an installation token for installation %d: %w", installationID, err)
+	}
+	return token.GetToken(), nil
+}
+
+// Returns the token which the gh CLI is logged in with, as output by gh auth token.
+func GHAuthToken(ctx context.Context) (string, error) {
+	return ghAuthToken(ctx, "gh")
+}
+
+// Returns the token output by the auth token command of the gh CLI at the given path.
+func ghAuthToken(ctx context.Context, ghPath string) (string, error) {
+	output, err := exec.CommandContext(ctx, ghPath, "auth", "token").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to get the token of the gh CLI, log in via gh auth login: %w", err)
+	}
+	token := strings.TrimSpace(string(output))
+	if len(token) == 0 {
+		return "", errors.New("failed to get the token of the gh CLI, log in via gh auth login")
+	}
+	return token, nil
+}
+
+// Returns the token in the file at the given path, falling back to the path in the GITHUB_TOKEN_FILE environment variable,
+// e.g. a secret mounted by a CI system. The token is trimmed of whitespace. Returns false if no path is given.
+func LoadTokenFile(path string) (string, bool, error) {
+	if len(path) == 0 {
+		path = os.Getenv("GITHUB_TOKEN_FILE")
+	}
+	if len(path) == 0 {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if len(token) == 0 {
+		return "", false, fmt.Errorf("token file %s is empty", path)
+	}
+	return token, true, nil
+}
+
+// Returns a GitHub client which authenticates as the given GitHub App installation if app is not nil,
+// otherwise with the given token if hasToken, otherwise unauthenticated.
+// Its requests are sent with the given client, e.g. to go through a proxy, or with http.DefaultClient if it is nil.
+// They are sent to the API of the GitHub Enterprise installation at baseURL if it is not empty, otherwise to api.github.com.
+func NewGitHubClient(ctx context.Context, app *AppCredentials, token string, hasToken bool, httpClient *http.Client, baseURL string) (*github.Client, error) {
+	// the oauth2 clients wrap the transport of the client in the context
+	baseCtx := context.Background()
+	if httpClient != nil {
+		baseCtx = context.WithValue(baseCtx, oauth2.HTTPClient, httpClient)
+	}
+	if app != nil {
+		jwt, err := appJWT(app.appID, app.privateKey, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		appClient, err := newGitHubClient(oauth2.NewClient(baseCtx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: jwt})), baseURL)
+		if err != nil {
+			return nil, err
+		}
+		token, err = installationToken(ctx, appClient, app.installationID)
+		if err != nil {
+			return nil, err
+		}
+		hasToken = true
+	}
+
+	if hasToken {
+		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+		return newGitHubClient(oauth2.NewClient(baseCtx, ts), baseURL)
+	}
+	return newGitHubClient(httpClient, baseURL)
+}
+
+// The base URL of the API of github.com, which GitHub Actions also sets GITHUB_API_URL to.
+const publicAPIURL = "https://api.github.com"
+
+// Returns a GitHub client which sends its requests with the given client to the API at baseURL, or to api.github.com if it is empty.
+func newGitHubClient(httpClient *http.Client, baseURL string) (*github.Client, error) {
+	if len(baseURL) == 0 || strings.TrimSuffix(baseURL, "/") == publicAPIURL {
+		// an Enterprise URL gets /api/v3/ appended, which api.github.com does not serve
+		return github.NewClient(httpClient), nil
+	}
+	client, err := github.NewEnterpriseClient(baseURL, baseURL, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid github-url %s: %w", baseURL, err)
+	}
+	return client, nil
+}
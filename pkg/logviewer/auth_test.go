@@ -0,0 +1,180 @@
+package logviewer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppJWT(t *testing.T) {
+	t.Parallel()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	now := time.Unix(1683055875, 0)
+
+	jwt, err := appJWT(123, privateKey, now)
+	assert.NoError(t, err)
+
+	parts := strings.Split(jwt, ".")
+	assert.Len(t, parts, 3)
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, digest[:], signature))
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	claims := map[string]int64{}
+	assert.NoError(t, json.Unmarshal(claimsJSON, &claims))
+	assert.Equal(t, map[string]int64{"iat": now.Unix() - 60, "exp": now.Unix() + 540, "iss": 123}, claims)
+}
+
+func TestLoadAppCredentials(t *testing.T) {
+	t.Parallel()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "key.pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}), 0o600))
+
+	app, err := LoadAppCredentials(123, 456, path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(123), app.appID)
+	assert.Equal(t, int64(456), app.installationID)
+	assert.True(t, privateKey.Equal(app.privateKey))
+
+	_, err = LoadAppCredentials(123, 0, path)
+	assert.EqualError(t, err, "app-id requires app-installation-id and app-private-key. see usage via --help")
+	assert.ErrorIs(t, err, ErrIncompleteAppCredentials)
+}
+
+func TestParsePrivateKeyPKCS8(t *testing.T) {
+	t.Parallel()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+
+	parsed, err := parsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.NoError(t, err)
+	assert.True(t, privateKey.Equal(parsed))
+
+	_, err = parsePrivateKey([]byte("not a key"))
+	assert.EqualError(t, err, "failed to parse app private key: no PEM data found")
+}
+
+func TestInstallationToken(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/installations/456/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"token": "ghs_abc"}`)
+	})
+	gh := newTestGitHubClient(t, mux)
+
+	token, err := installationToken(context.Background(), gh, 456)
+	assert.NoError(t, err)
+	assert.Equal(t, "ghs_abc", token)
+}
+
+// A RoundTripper which records the requests sent through it before sending them with http.DefaultTransport.
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewGitHubClientWithHTTPClient(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "octocat"}`)
+	}))
+	t.Cleanup(server.Close)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+
+	for _, hasToken := range []bool{true, false} {
+		transport := &recordingTransport{}
+		gh, err := NewGitHubClient(context.Background(), nil, "ghp_abc", hasToken, &http.Client{Transport: transport}, "")
+		assert.NoError(t, err)
+		gh.BaseURL = baseURL
+		_, _, err = gh.Users.Get(context.Background(), "")
+		assert.NoError(t, err)
+		assert.Len(t, transport.requests, 1)
+		if hasToken {
+			assert.Equal(t, "Bearer ghp_abc", transport.requests[0].Header.Get("Authorization"))
+		} else {
+			assert.Empty(t, transport.requests[0].Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestLoadTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(path, []byte("ghp_abc\n"), 0o600))
+
+	token, ok, err := LoadTokenFile(path)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "ghp_abc", token)
+
+	t.Setenv("GITHUB_TOKEN_FILE", path)
+	token, ok, err = LoadTokenFile("")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "ghp_abc", token)
+
+	t.Setenv("GITHUB_TOKEN_FILE", "")
+	_, ok, err = LoadTokenFile("")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	empty := filepath.Join(dir, "empty")
+	assert.NoError(t, os.WriteFile(empty, []byte(" \n"), 0o600))
+	_, _, err = LoadTokenFile(empty)
+	assert.EqualError(t, err, "token file "+empty+" is empty")
+
+	_, _, err = LoadTokenFile(filepath.Join(dir, "missing"))
+	assert.ErrorContains(t, err, "failed to read token file")
+}
+
+func TestGHAuthToken(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writeGH := func(script string) string {
+		path := filepath.Join(dir, fmt.Sprintf("gh-%d", len(script)))
+		assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755))
+		return path
+	}
+
+	token, err := ghAuthToken(context.Background(), writeGH(`[ "$1 $2" = "auth token" ] && echo gho_abc`+"\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "gho_abc", token)
+
+	_, err = ghAuthToken(context.Background(), writeGH("echo 'no oauth token found' >&2\nexit 1\n"))
+	assert.EqualError(t, err, "failed to get the token of the gh CLI, log in via gh auth login: exit status 1: no oauth token found")
+
+	_, err = ghAuthToken(context.Background(), filepath.Join(dir, "missing"))
+	assert.ErrorContains(t, err, "failed to get the token of the gh CLI, log in via gh auth login")
+}
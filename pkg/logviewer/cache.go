@@ -0,0 +1,135 @@
+package logviewer
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How long a resolved workflow run or job is read from the cache before it is looked up again.
+// The latest run of a workflow changes whenever a new run completes, so it is only cached briefly.
+const resolvedTTL = 5 * time.Minute
+
+// A directory of raw job logs which have already been downloaded, keyed by the API host, run, and job they belong to.
+// The host is part of the key because the IDs of runs and jobs are only unique within one GitHub instance.
+type LogCache struct {
+	dir string
+}
+
+// Returns the logCache in the user's cache directory, e.g. $XDG_CACHE_HOME/terratestlogviewer.
+func DefaultLogCache() (*LogCache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the cache directory: %w", err)
+	}
+	return &LogCache{dir: filepath.Join(dir, "terratestlogviewer")}, nil
+}
+
+// Returns the directory the logs are cached in.
+func (c *LogCache) Dir() string {
+	return c.dir
+}
+
+func (c *LogCache) path(host string, owner string, repo string, runID int64, jobID int64) string {
+	return filepath.Join(c.dir, host, owner, repo, fmt.Sprintf("%d-%d.log", runID, jobID))
+}
+
+// Returns a reader of the cached logs of the given job, or false if they are not cached. The caller must close the reader.
+func (c *LogCache) open(host string, owner string, repo string, runID int64, jobID int64) (io.ReadCloser, bool, error) {
+	file, err := os.Open(c.path(host, owner, repo, runID, jobID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to read cached logs: %w", err)
+	}
+	return file, true, nil
+}
+
+// Returns a reader of the given logs which saves them to the cache once they have been read in full.
+// Logs which are closed before they are read in full are not cached. The caller must close the reader.
+func (c *LogCache) store(host string, owner string, repo string, runID int64, jobID int64, logs io.ReadCloser) (io.ReadCloser, error) {
+	path := c.path(host, owner, repo, runID, jobID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the cache directory: %w", err)
+	}
+	// logs are written to a temporary file first so that a partial download is never read from the cache
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the cache file: %w", err)
+	}
+	return &cachingReader{logs: logs, file: file, path: path}, nil
+}
+
+func (c *LogCache) resolvedPath(host string, owner string, repo string, key string) string {
+	// the key holds names such as branches which can contain any character, so it is hashed to get a valid file name
+	return filepath.Join(c.dir, host, owner, repo, "resolved", fmt.Sprintf("%x.json", sha256.Sum256([]byte(key))))
+}
+
+// Reads the value resolved for the given key into v, and returns whether it was cached less than resolvedTTL ago.
+func (c *LogCache) loadResolved(host string, owner string, repo string, key string, v any) bool {
+	path := c.resolvedPath(host, owner, repo, key)
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > resolvedTTL {
+		return false
+	}
+	content, err := os.ReadFile(path)
+	return err == nil && json.Unmarshal(content, v) == nil
+}
+
+// Saves the value resolved for the given key to the cache.
+// Failing to cache the value only makes the next lookup slower, so any error is ignored.
+func (c *LogCache) storeResolved(host string, owner string, repo string, key string, v any) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	path := c.resolvedPath(host, owner, repo, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	os.WriteFile(path, content, 0o644)
+}
+
+// Removes every cached log.
+func (c *LogCache) Clear() error {
+	return os.RemoveAll(c.dir)
+}
+
+// An io.ReadCloser which copies everything read from logs into file, then moves file to path when closed if logs were read in full.
+type cachingReader struct {
+	logs     io.ReadCloser
+	file     *os.File
+	path     string
+	complete bool
+	writeErr error
+}
+
+func (c *cachingReader) Read(p []byte) (int, error) {
+	n, err := c.logs.Read(p)
+	if n > 0 && c.writeErr == nil {
+		_, c.writeErr = c.file.Write(p[:n])
+	}
+	if err == io.EOF {
+		c.complete = true
+	}
+	return n, err
+}
+
+func (c *cachingReader) Close() error {
+	err := c.logs.Close()
+	fileErr := c.file.Close()
+	if c.complete && c.writeErr == nil && fileErr == nil {
+		// failing to cache the logs does not stop them from being shown, so any error here is ignored
+		if os.Rename(c.file.Name(), c.path) == nil {
+			return err
+		}
+	}
+	os.Remove(c.file.Name())
+	return err
+}
@@ -0,0 +1,81 @@
+package logviewer
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogCache(t *testing.T) {
+	t.Parallel()
+	cache := &LogCache{dir: t.TempDir()}
+
+	_, ok, err := cache.open("api.github.com", "owner", "repo", 1, 2)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	logs, err := cache.store("api.github.com", "owner", "repo", 1, 2, io.NopCloser(strings.NewReader("TestFoo 1\n")))
+	assert.NoError(t, err)
+	_, err = io.ReadAll(logs)
+	assert.NoError(t, err)
+	assert.NoError(t, logs.Close())
+
+	cachedLogs, ok, err := cache.open("api.github.com", "owner", "repo", 1, 2)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	defer cachedLogs.Close()
+	content, err := io.ReadAll(cachedLogs)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestFoo 1\n", string(content))
+
+	// the same IDs on another GitHub instance belong to another job
+	_, ok, err = cache.open("github.example.com", "owner", "repo", 1, 2)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, cache.Clear())
+	_, ok, err = cache.open("api.github.com", "owner", "repo", 1, 2)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+// logs which are not read in full, e.g. because of --fail-fast, must not be cached because they are incomplete
+func TestLogCacheSkipsPartialLogs(t *testing.T) {
+	t.Parallel()
+	cache := &LogCache{dir: t.TempDir()}
+
+	logs, err := cache.store("api.github.com", "owner", "repo", 1, 2, io.NopCloser(strings.NewReader("TestFoo 1\nTestFoo 2\n")))
+	assert.NoError(t, err)
+	_, err = logs.Read(make([]byte, 4))
+	assert.NoError(t, err)
+	assert.NoError(t, logs.Close())
+
+	_, ok, err := cache.open("api.github.com", "owner", "repo", 1, 2)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	entries, err := os.ReadDir(cache.dir + "/api.github.com/owner/repo")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLogCacheResolved(t *testing.T) {
+	t.Parallel()
+	cache := &LogCache{dir: t.TempDir()}
+	value := map[string]int{}
+
+	assert.False(t, cache.loadResolved("api.github.com", "owner", "repo", "run\x00test.yml\x00feature/foo", &value))
+	cache.storeResolved("api.github.com", "owner", "repo", "run\x00test.yml\x00feature/foo", map[string]int{"id": 1})
+	assert.True(t, cache.loadResolved("api.github.com", "owner", "repo", "run\x00test.yml\x00feature/foo", &value))
+	assert.Equal(t, map[string]int{"id": 1}, value)
+	assert.False(t, cache.loadResolved("api.github.com", "owner", "repo", "run\x00test.yml\x00main", &value))
+	assert.False(t, cache.loadResolved("github.example.com", "owner", "repo", "run\x00test.yml\x00feature/foo", &value))
+
+	// a value cached too long ago may be out of date
+	expired := time.Now().Add(-resolvedTTL - time.Minute)
+	assert.NoError(t, os.Chtimes(cache.resolvedPath("api.github.com", "owner", "repo", "run\x00test.yml\x00feature/foo"), expired, expired))
+	assert.False(t, cache.loadResolved("api.github.com", "owner", "repo", "run\x00test.yml\x00feature/foo", &value))
+}
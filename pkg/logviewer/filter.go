@@ -0,0 +1,291 @@
+package logviewer
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The fields of a log line which a filter expression can test.
+type LineFields struct {
+	// Test is the name of the test which logged the line, e.g. TestFoo/subcase, or empty if it was not logged by a test.
+	// Like FilterLogsTransform, a line which does not start with a test name belongs to the test of the line before it.
+	Test string
+	// Timestamp is when the line was logged. A line without a timestamp has the timestamp of the line before it.
+	Timestamp time.Time
+	// Message is the line without its timestamp, test name, and trailing newline.
+	Message string
+}
+
+// Returns whether a log line with the given fields is selected by a filter expression.
+type LineFilter func(fields LineFields) bool
+
+// Parses a filter expression which selects log lines by their fields, e.g. `test == "TestFoo" && message contains "Error"`.
+// A comparison is a field (test, timestamp, or message), an operator, and a double-quoted string.
+// The test and message fields support ==, !=, contains, and matches (a regular expression), and the timestamp field
+// supports ==, !=, <, <=, >, and >= against an RFC 3339 timestamp. Comparisons combine with &&, ||, !, and parentheses.
+func ParseFilter(expr string) (LineFilter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	parser := &filterParser{tokens: tokens}
+	filter, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != filterEnd {
+		return nil, fmt.Errorf("invalid filter: unexpected %s at offset %d", token.text, token.offset)
+	}
+	return filter, nil
+}
+
+// Returns a transform which includes only the log lines selected by the given filter.
+// Timestamps must parse using the given layout, or RFC 3339 if it is empty. A line which starts with testPrefix starts the logs of a new test.
+func FilterLinesTransform(filter LineFilter, layout string, testPrefix string) Transform {
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+
+	return func(r io.Reader, w io.Writer) error {
+		fields := LineFields{}
+		return forEachLine(r, func(taggedLine []byte) error {
+			line, _ := cutRawLine(taggedLine)
+			timestamp, offset, err := parseTimestampPrefix(line, 0, layout)
+			if err == nil {
+				fields.Timestamp = timestamp
+			}
+			fields.Message = string(line[offset:])
+			if hasPrefix(line, offset, []byte(testPrefix)) {
+				testName := leadingToken(line, offset)
+				fields.Test = string(testName)
+				fields.Message = strings.TrimPrefix(string(line[offset+len(testName):]), " ")
+			} else if nameOffset := testMarkerNameOffset(line, offset); nameOffset >= 0 {
+				fields.Test = string(leadingToken(line, nameOffset))
+			}
+			fields.Message = strings.TrimRight(fields.Message, "\r\n")
+			if !filter(fields) {
+				return nil
+			}
+			_, err = w.Write(taggedLine)
+			return err
+		})
+	}
+}
+
+type filterTokenKind int
+
+const (
+	filterEnd filterTokenKind = iota
+	filterWord
+	filterString
+	filterOperator
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	// text is the unquoted value of a string, and the source of any other token.
+	text   string
+	offset int
+}
+
+// The operators of a filter expression, longest first so that e.g. <= is not read as <.
+var filterOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("invalid filter: unterminated string at offset %d", i)
+			}
+			value, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter: invalid string at offset %d", i)
+			}
+			tokens = append(tokens, filterToken{kind: filterString, text: value, offset: i})
+			i = end + 1
+		case c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+			end := i
+			for end < len(expr) && (expr[end] == '_' || ('a' <= expr[end] && expr[end] <= 'z') || ('A' <= expr[end] && expr[end] <= 'Z')) {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: filterWord, text: expr[i:end], offset: i})
+			i = end
+		default:
+			operator := ""
+			for _, candidate := range filterOperators {
+				if strings.HasPrefix(expr[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if len(operator) == 0 {
+				return nil, fmt.Errorf("invalid filter: unexpected %q at offset %d", c, i)
+			}
+			tokens = append(tokens, filterToken{kind: filterOperator, text: operator, offset: i})
+			i += len(operator)
+		}
+	}
+	return append(tokens, filterToken{kind: filterEnd, text: "end of filter", offset: len(expr)}), nil
+}
+
+// A recursive descent parser of filter expressions. && binds more tightly than ||, and ! more tightly than both.
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	token := p.tokens[p.pos]
+	if token.kind != filterEnd {
+		p.pos++
+	}
+	return token
+}
+
+// Consumes the next token if it is the given operator, and returns whether it was.
+func (p *filterParser) accept(operator string) bool {
+	if token := p.peek(); token.kind == filterOperator && token.text == operator {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (LineFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		prior := left
+		left = func(fields LineFields) bool { return prior(fields) || right(fields) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (LineFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		prior := left
+		left = func(fields LineFields) bool { return prior(fields) && right(fields) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (LineFilter, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(fields LineFields) bool { return !operand(fields) }, nil
+	}
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			token := p.peek()
+			return nil, fmt.Errorf("invalid filter: expected ) at offset %d", token.offset)
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (LineFilter, error) {
+	field := p.next()
+	if field.kind != filterWord || (field.text != "test" && field.text != "timestamp" && field.text != "message") {
+		return nil, fmt.Errorf("invalid filter: expected test, timestamp, or message at offset %d", field.offset)
+	}
+	operator := p.next()
+	if operator.kind != filterOperator && operator.kind != filterWord {
+		return nil, fmt.Errorf("invalid filter: expected an operator at offset %d", operator.offset)
+	}
+	value := p.next()
+	if value.kind != filterString {
+		return nil, fmt.Errorf("invalid filter: expected a double-quoted string at offset %d", value.offset)
+	}
+
+	if field.text == "timestamp" {
+		return timestampComparison(operator, value)
+	}
+	fieldValue := func(fields LineFields) string {
+		if field.text == "test" {
+			return fields.Test
+		}
+		return fields.Message
+	}
+	switch operator.text {
+	case "==":
+		return func(fields LineFields) bool { return fieldValue(fields) == value.text }, nil
+	case "!=":
+		return func(fields LineFields) bool { return fieldValue(fields) != value.text }, nil
+	case "contains":
+		return func(fields LineFields) bool { return strings.Contains(fieldValue(fields), value.text) }, nil
+	case "matches":
+		regex, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: invalid regular expression at offset %d: %w", value.offset, err)
+		}
+		return func(fields LineFields) bool { return regex.MatchString(fieldValue(fields)) }, nil
+	default:
+		return nil, fmt.Errorf("invalid filter: %s must be compared with ==, !=, contains, or matches at offset %d", field.text, operator.offset)
+	}
+}
+
+// The operators which compare a timestamp field with a timestamp.
+var timestampOperators = map[string]func(timestamp time.Time, at time.Time) bool{
+	"==": func(timestamp time.Time, at time.Time) bool { return timestamp.Equal(at) },
+	"!=": func(timestamp time.Time, at time.Time) bool { return !timestamp.Equal(at) },
+	"<":  func(timestamp time.Time, at time.Time) bool { return timestamp.Before(at) },
+	"<=": func(timestamp time.Time, at time.Time) bool { return !timestamp.After(at) },
+	">":  func(timestamp time.Time, at time.Time) bool { return timestamp.After(at) },
+	">=": func(timestamp time.Time, at time.Time) bool { return !timestamp.Before(at) },
+}
+
+func timestampComparison(operator filterToken, value filterToken) (LineFilter, error) {
+	compare, ok := timestampOperators[operator.text]
+	if !ok {
+		return nil, fmt.Errorf("invalid filter: timestamp must be compared with ==, !=, <, <=, >, or >= at offset %d", operator.offset)
+	}
+	at, err := time.Parse(time.RFC3339Nano, value.text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: invalid RFC 3339 timestamp at offset %d", value.offset)
+	}
+	// a line logged before any timestamp was seen has no time to compare
+	return func(fields LineFields) bool { return !fields.Timestamp.IsZero() && compare(fields.Timestamp, at) }, nil
+}
@@ -0,0 +1,59 @@
+package logviewer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func filterLines(t *testing.T, logs string, expr string) string {
+	filter, err := ParseFilter(expr)
+	assert.NoError(t, err)
+	actual, err := transformBytes([]byte(logs), FilterLinesTransform(filter, "", DefaultTestPrefix))
+	assert.NoError(t, err)
+	return string(actual)
+}
+
+func TestFilterLines(t *testing.T) {
+	t.Parallel()
+	logs := "2023-05-02T19:31:15Z TestFoo Error: bad\n" +
+		"no prefix Error: worse\n" +
+		"2023-05-02T19:31:16Z TestBar Error: bad\n" +
+		"2023-05-02T19:31:17Z TestFoo ok\n" +
+		"2023-05-02T19:31:18Z --- FAIL: TestFoo (3.00s)\n"
+
+	assert.Equal(t, "2023-05-02T19:31:15Z TestFoo Error: bad\nno prefix Error: worse\n",
+		filterLines(t, logs, `test == "TestFoo" && message contains "Error"`))
+	assert.Equal(t, "2023-05-02T19:31:16Z TestBar Error: bad\n2023-05-02T19:31:18Z --- FAIL: TestFoo (3.00s)\n",
+		filterLines(t, logs, `test == "TestBar" || message matches "^--- FAIL"`))
+	assert.Equal(t, "2023-05-02T19:31:17Z TestFoo ok\n2023-05-02T19:31:18Z --- FAIL: TestFoo (3.00s)\n",
+		filterLines(t, logs, `timestamp >= "2023-05-02T19:31:17Z"`))
+	// lines without a timestamp have the timestamp of the line before them
+	assert.Equal(t, "2023-05-02T19:31:15Z TestFoo Error: bad\nno prefix Error: worse\n",
+		filterLines(t, logs, `timestamp < "2023-05-02T19:31:16Z"`))
+	assert.Equal(t, "2023-05-02T19:31:17Z TestFoo ok\n",
+		filterLines(t, logs, `!(message contains "Error" || test != "TestFoo") && !message matches "FAIL"`))
+	assert.Equal(t, "2023-05-02T19:31:17Z TestFoo ok\n",
+		filterLines(t, logs, `message == "ok"`))
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	t.Parallel()
+	for expr, wantErr := range map[string]string{
+		`test == "TestFoo`:                  "invalid filter: unterminated string at offset 8",
+		`name == "TestFoo"`:                 "invalid filter: expected test, timestamp, or message at offset 0",
+		`test == TestFoo`:                   "invalid filter: expected a double-quoted string at offset 8",
+		`test < "TestFoo"`:                  "invalid filter: test must be compared with ==, !=, contains, or matches at offset 5",
+		`timestamp contains "2023"`:         "invalid filter: timestamp must be compared with ==, !=, <, <=, >, or >= at offset 10",
+		`timestamp > "yesterday"`:           "invalid filter: invalid RFC 3339 timestamp at offset 12",
+		`(test == "TestFoo"`:                "invalid filter: expected ) at offset 18",
+		`test == "TestFoo" message == "ok"`: "invalid filter: unexpected message at offset 18",
+		`test == "TestFoo" $`:               "invalid filter: unexpected '$' at offset 18",
+		``:                                  "invalid filter: expected test, timestamp, or message at offset 0",
+	} {
+		_, err := ParseFilter(expr)
+		assert.EqualError(t, err, wantErr, expr)
+	}
+	_, err := ParseFilter(`message matches "("`)
+	assert.ErrorContains(t, err, "invalid filter: invalid regular expression at offset 16")
+}
@@ -0,0 +1,482 @@
+package logviewer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A log line in the json output format.
+type jsonLogLine struct {
+	Test      *string    `json:"test"`
+	Timestamp *time.Time `json:"timestamp"`
+	Message   string     `json:"message"`
+	RawLine   int        `json:"raw_line,omitempty"`
+}
+
+// Returns a transform which formats raw logs as one JSON object per line, including the raw line number of lines numbered by NumberRawLinesTransform.
+// If layout is empty, timestamps are parsed as RFC 3339. Lines without a parseable timestamp have a null timestamp.
+// If matchesTest is not nil, only lines which are part of a selected test are included.
+// Lines are attributed to tests like FilterLogsTransform, and a line which starts with the name of its test has the name
+// removed from its message if removePrefix is set. Lines which are not part of any test have a null test.
+// The names of tests start with testPrefix, e.g. DefaultTestPrefix.
+func FormatJSONTransform(layout string, matchesTest TestMatcher, removePrefix bool, testPrefix string) Transform {
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+
+	return func(r io.Reader, w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		selection := testSelection{matchesTest: matchesTest, testPrefix: []byte(testPrefix)}
+		if matchesTest == nil {
+			selection.matchesTest = testPrefixMatcher(testPrefix)
+		}
+		return forEachLine(r, func(taggedLine []byte) error {
+			rawLine, rawLineNumber := cutRawLine(taggedLine)
+			timestamp, startOfMessageIdx, timestampErr := parseTimestampPrefix(rawLine, 0, layout)
+
+			testName, selected := selection.next(rawLine, startOfMessageIdx)
+			if !selected && matchesTest != nil {
+				return nil
+			}
+
+			line := jsonLogLine{RawLine: rawLineNumber}
+			if timestampErr == nil {
+				line.Timestamp = &timestamp
+			}
+			if testName != nil {
+				name := string(testName)
+				line.Test = &name
+				if removePrefix && hasPrefix(rawLine, startOfMessageIdx, testName) && hasPrefix(rawLine, startOfMessageIdx+len(testName), []byte(" ")) {
+					startOfMessageIdx += len(testName) + 1
+				}
+			}
+			line.Message = strings.TrimSuffix(string(rawLine[startOfMessageIdx:]), "\n")
+
+			return encoder.Encode(line)
+		})
+	}
+}
+
+// Returns a TestMatcher which selects every test, whose names start with the given prefix.
+func testPrefixMatcher(testPrefix string) TestMatcher {
+	return func(str []byte, offset int) []byte {
+		if hasPrefix(str, offset, []byte(testPrefix)) {
+			return leadingToken(str, offset)
+		}
+		return nil
+	}
+}
+
+// A test suite in the junit output format.
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr,omitempty"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// A test case in the junit output format.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+// The failure of a test case in the junit output format.
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",chardata"`
+}
+
+// Matches a test result line, e.g. "    --- FAIL: TestA/foo (1.23s)".
+var testResultRegex = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (\S+)(?: \(([\d.]+)s\))?`)
+
+// Returns a transform which formats logs without timestamps as a junit test suite with the given name, containing one test case per test result.
+// Subtests keep their full name, e.g. "TestA/foo", and have their top-level test as their class name.
+// The body of a failure is the indented output which followed the failing test's "=== RUN", "=== CONT", "=== NAME", or "--- FAIL" lines.
+// If matchesTest is not nil, only the results of selected tests are included.
+func FormatJUnitTransform(name string, matchesTest TestMatcher) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		suite := junitTestSuite{Name: name}
+		testOutput := map[string]*strings.Builder{}
+		// the test which owns the indented lines that follow, if any
+		var outputTest *strings.Builder
+		err := forEachLine(r, func(line []byte) error {
+			for _, marker := range testOutputMarkers {
+				if testName, ok := bytes.CutPrefix(line, marker); ok {
+					outputTest = builderFor(testOutput, string(bytes.TrimSpace(testName)))
+					return nil
+				}
+			}
+
+			result := testResultRegex.FindSubmatch(line)
+			if result == nil {
+				if outputTest != nil && (hasPrefix(line, 0, []byte(" ")) || hasPrefix(line, 0, []byte("\t"))) {
+					outputTest.Write(line)
+				} else {
+					outputTest = nil
+				}
+				return nil
+			}
+
+			testName := string(result[2])
+			outputTest = nil
+			if string(result[1]) == "FAIL" {
+				outputTest = builderFor(testOutput, testName)
+			}
+			if matchesTest != nil && matchesTest(result[2], 0) == nil {
+				return nil
+			}
+			className, _, _ := strings.Cut(testName, "/")
+			testCase := junitTestCase{Name: testName, ClassName: className, Time: string(result[3])}
+			if string(result[1]) == "FAIL" {
+				suite.Failures++
+				testCase.Failure = &junitFailure{Message: string(bytes.TrimSpace(line))}
+			} else if string(result[1]) == "SKIP" {
+				suite.Skipped++
+				testCase.Skipped = &struct{}{}
+			}
+			suite.Tests++
+			suite.TestCases = append(suite.TestCases, testCase)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// the failure output can follow the result, so it is attached once all the logs are read
+		for i := range suite.TestCases {
+			if failure := suite.TestCases[i].Failure; failure != nil {
+				if output, ok := testOutput[suite.TestCases[i].Name]; ok {
+					failure.Output = output.String()
+				}
+			}
+		}
+
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(suite); err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "\n")
+		return err
+	}
+}
+
+// Returns the builder for the given key, adding an empty one if there is none.
+func builderFor(builders map[string]*strings.Builder, key string) *strings.Builder {
+	builder, ok := builders[key]
+	if !ok {
+		builder = &strings.Builder{}
+		builders[key] = builder
+	}
+	return builder
+}
+
+// Returns a transform which formats logs without timestamps as markdown for pasting into e.g. a pull request comment.
+// The lines of each top-level test are grouped into a collapsible <details> block whose summary has the test's result,
+// which is expanded if the test failed. Lines are attributed to tests in the same way as the json format, and a test's
+// results, including those of its subtests, end its block. If matchesTest is not nil, only selected tests are included.
+// If removePrefix is set, the test name is removed from the start of each line, as the block already names the test.
+// The names of tests start with testPrefix, e.g. DefaultTestPrefix.
+func FormatMarkdownTransform(matchesTest TestMatcher, removePrefix bool, testPrefix string) Transform {
+	if matchesTest == nil {
+		matchesTest = testPrefixMatcher(testPrefix)
+	}
+
+	return func(r io.Reader, w io.Writer) error {
+		// the top-level tests in the order they first logged a line, each with its lines and result
+		testNames := []string{}
+		testLines := map[string]*strings.Builder{}
+		testResults := map[string]string{}
+		selection := testSelection{matchesTest: matchesTest, testPrefix: []byte(testPrefix)}
+		currentTest := ""
+		err := forEachLine(r, func(line []byte) error {
+			group := func(testName []byte) *strings.Builder {
+				topLevelTest, _, _ := strings.Cut(string(testName), "/")
+				if _, ok := testLines[topLevelTest]; !ok {
+					testNames = append(testNames, topLevelTest)
+				}
+				currentTest = topLevelTest
+				return builderFor(testLines, topLevelTest)
+			}
+
+			if result := testResultRegex.FindSubmatch(line); result != nil {
+				if matchesTest(result[2], 0) != nil {
+					group(result[2]).Write(bytes.TrimLeft(line, " \t"))
+					if !bytes.Contains(result[2], []byte("/")) {
+						testResults[string(result[2])] = string(result[1])
+					}
+				}
+				// a result is not part of the output of the test before it
+				selection.currentTest = nil
+				return nil
+			}
+
+			testName, selected := selection.next(line, 0)
+			if !selected {
+				return nil
+			}
+			message := line
+			if testName != nil {
+				if removePrefix && hasPrefix(line, 0, testName) && hasPrefix(line, len(testName), []byte(" ")) {
+					message = line[len(testName)+1:]
+				}
+				group(testName).Write(message)
+			} else if len(currentTest) > 0 {
+				testLines[currentTest].Write(message)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, testName := range testNames {
+			details := "<details>"
+			summary := testName
+			if result, ok := testResults[testName]; ok {
+				summary += " (" + result + ")"
+				if result == "FAIL" {
+					details = "<details open>"
+				}
+			}
+			body := strings.TrimSuffix(testLines[testName].String(), "\n")
+			if _, err := fmt.Fprintf(w, "%s<summary>%s</summary>\n\n```\n%s\n```\n\n</details>\n\n", details, summary, body); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorCyan    = "\x1b[36m"
+	colorBoldRed = "\x1b[1;31m"
+)
+
+// An io.Writer which colorizes passed, failed, and skipped test results and Terraform errors line by line before writing them to w.
+// Call Flush after the last write to write a final line which has no trailing newline.
+type ColorWriter struct {
+	w    io.Writer
+	line []byte
+}
+
+// Returns a ColorWriter which writes to w.
+func NewColorWriter(w io.Writer) *ColorWriter {
+	return &ColorWriter{w: w}
+}
+
+func (c *ColorWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		endOfLineIdx := bytes.IndexByte(p, '\n')
+		if endOfLineIdx < 0 {
+			c.line = append(c.line, p...)
+			break
+		}
+		c.line = append(c.line, p[:endOfLineIdx+1]...)
+		p = p[endOfLineIdx+1:]
+		if err := c.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Writes the buffered line, if there is one.
+func (c *ColorWriter) Flush() error {
+	if len(c.line) == 0 {
+		return nil
+	}
+	defer func() { c.line = c.line[:0] }()
+
+	line := bytes.TrimSuffix(c.line, []byte("\n"))
+	color := ""
+	if bytes.Contains(line, testFailResult) {
+		color = colorRed
+	} else if bytes.Contains(line, testPassResult) {
+		color = colorGreen
+	} else if bytes.Contains(line, testSkipResult) {
+		color = colorYellow
+	} else if bytes.Contains(line, terraformError) {
+		color = colorBoldRed
+	}
+	if len(color) == 0 {
+		_, err := c.w.Write(c.line)
+		return err
+	}
+	_, err := fmt.Fprintf(c.w, "%s%s%s%s", color, line, colorReset, c.line[len(line):])
+	return err
+}
+
+// The lines which start a Terraform plan, after which the resource changes are listed.
+var terraformPlanStarts = [][]byte{
+	[]byte("Terraform used the selected providers to generate the following execution"),
+	[]byte("Terraform will perform the following actions:"),
+	[]byte("Terraform planned the following actions"),
+}
+
+var (
+	terraformPlanSummary   = []byte("Plan: ")
+	terraformPlanNoChanges = []byte("No changes.")
+)
+
+// Matches a change line of a Terraform plan, e.g. `      + ami = "ami-123"`, after any prefix such as a test name or a Terratest logger location.
+// The submatches are the prefix, the indentation of the change, and its indicator.
+var terraformPlanChange = regexp.MustCompile(`^(.*?(?:^| ))( *)(-/\+|\+/-|<=|[-+~]) `)
+
+// The colors of the change indicators of a Terraform plan. Replacements are colored like updates.
+var terraformPlanChangeColors = map[string]string{
+	"+":   colorGreen,
+	"-":   colorRed,
+	"~":   colorYellow,
+	"-/+": colorYellow,
+	"+/-": colorYellow,
+	"<=":  colorCyan,
+}
+
+// Returns a transform which lines up the change indicators of Terraform plans like a diff, colorizing them if color is set.
+// A plan starts at the line which introduces its changes and ends at its "Plan:" summary, its "No changes." line,
+// or the next terraform invocation. The indicator of each change line is moved before the indentation of the change,
+// so that the +, -, and ~ of nested attributes line up in one column while the changes keep their columns.
+// Lines outside of plans are unchanged.
+func HighlightPlanTransform(color bool) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		inPlan := false
+		return forEachLine(r, func(line []byte) error {
+			if matchingContains(line, terraformPlanStarts) {
+				inPlan = true
+			} else if inPlan && (bytes.Contains(line, terraformPlanSummary) || bytes.Contains(line, terraformPlanNoChanges) || bytes.Contains(line, terraformCommand)) {
+				inPlan = false
+			} else if inPlan {
+				if match := terraformPlanChange.FindSubmatchIndex(line); match != nil {
+					prefix, indicator := line[:match[3]], string(line[match[6]:match[7]])
+					gutter := fmt.Sprintf("%-*s", match[7]-match[4], indicator)
+					if color {
+						gutter = terraformPlanChangeColors[indicator] + gutter + colorReset
+					}
+					_, err := fmt.Fprintf(w, "%s%s%s", prefix, gutter, line[match[7]:])
+					return err
+				}
+			}
+			_, err := w.Write(line)
+			return err
+		})
+	}
+}
+
+// The file which SplitByTestTransform writes the lines which are not part of any test to.
+const UnattributedLogFile = "_unattributed.log"
+
+// Returns a transform which writes the lines of each test to its own file in dir, named after the test with any "/" replaced
+// by "__", e.g. TestFoo__subcase.log. Lines are attributed to tests in the same way as the json format, and lines which are
+// not part of any test are written to UnattributedLogFile. If matchesTest is not nil, only the lines of selected tests are written.
+// Outputs the name of each file written and how many lines were written to it, sorted by name. The names of tests start with testPrefix,
+// e.g. DefaultTestPrefix, and kept timestamps must parse using the given layout, or RFC 3339 if it is empty.
+func SplitByTestTransform(matchesTest TestMatcher, dir string, testPrefix string, layout string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create the output directory: %w", err)
+		}
+		lineCounts := map[string]int{}
+		// only the file of the test whose lines are being written is open, so that a suite with many tests does not run out of file descriptors
+		var file *os.File
+		var writer *bufio.Writer
+		closeFile := func() error {
+			if file == nil {
+				return nil
+			}
+			flushErr := writer.Flush()
+			closeErr := file.Close()
+			file = nil
+			if flushErr != nil {
+				return fmt.Errorf("failed to write output: %w", flushErr)
+			}
+			if closeErr != nil {
+				return fmt.Errorf("failed to write output: %w", closeErr)
+			}
+			return nil
+		}
+		writeLine := func(name string, line []byte) error {
+			if file == nil || filepath.Base(file.Name()) != name {
+				if err := closeFile(); err != nil {
+					return err
+				}
+				// a test's lines resume after another test's are appended to its file, which is otherwise replaced
+				flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+				if lineCounts[name] == 0 {
+					flags |= os.O_TRUNC
+				}
+				openedFile, err := os.OpenFile(filepath.Join(dir, name), flags, 0o644)
+				if err != nil {
+					return fmt.Errorf("failed to write output: %w", err)
+				}
+				file = openedFile
+				writer = bufio.NewWriter(file)
+			}
+			lineCounts[name]++
+			_, err := writer.Write(line)
+			return err
+		}
+
+		// every test is attributed, then only the lines of selected tests are kept
+		selection := testSelection{matchesTest: testPrefixMatcher(testPrefix), testPrefix: []byte(testPrefix)}
+		var currentTest []byte
+		err := forEachLine(r, func(line []byte) error {
+			testName, attributed := selection.next(line, startOfMessage(line, layout))
+			if testName != nil {
+				currentTest = testName
+			} else if !attributed {
+				currentTest = nil
+			}
+			if currentTest == nil {
+				return writeLine(UnattributedLogFile, line)
+			}
+			if matchesTest != nil && matchesTest(currentTest, 0) == nil {
+				return nil
+			}
+			return writeLine(strings.ReplaceAll(string(currentTest), "/", "__")+".log", line)
+		})
+		if closeErr := closeFile(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(lineCounts))
+		for name := range lineCounts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, err := fmt.Fprintf(w, "%s\t%d\n", name, lineCounts[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
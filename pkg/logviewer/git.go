@@ -0,0 +1,99 @@
+package logviewer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// Matches https, ssh, git, and scp-like (git@host:owner/repo) remote URLs. The submatches are the owner and repo.
+var gitRegex = regexp.MustCompile(`^(?:(?:https?|ssh|git)://)?(?:[\w.-]+@)?[\w.-]+(?::\d+)?[/:]([\w.-]+)/([\w.-]+?)(?:\.git)?/?$`)
+
+func FindGitDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return "", err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() && entry.Name() == ".git" {
+				return filepath.Join(dir, entry.Name()), nil
+			}
+		}
+
+		dir = filepath.Dir(dir)
+		if dir == "/" {
+			return "", fmt.Errorf("did not find .git folder before reaching filesystem root")
+		}
+	}
+}
+
+// Returns the owner and repo of the origin remote, or of the only remote if there is no origin.
+func ParseRemoteOwnerAndRepo(r *git.Repository) (string, string, error) {
+	remotes, err := r.Remotes()
+	if err != nil {
+		return "", "", err
+	}
+
+	var remote *git.Remote
+	for _, candidate := range remotes {
+		if candidate.Config().Name == git.DefaultRemoteName {
+			remote = candidate
+		}
+	}
+	if remote == nil {
+		if len(remotes) != 1 {
+			return "", "", fmt.Errorf("can't parse owner and repo with more than one remote and none named %s", git.DefaultRemoteName)
+		}
+		remote = remotes[0]
+	}
+
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return "", "", fmt.Errorf("remote %s has no URL", remote.Config().Name)
+	}
+	return ParseOwnerAndRepo(urls[0])
+}
+
+// Returns the owner and repo in the given remote URL.
+func ParseOwnerAndRepo(url string) (string, string, error) {
+	matches := gitRegex.FindStringSubmatch(url)
+	if len(matches) < 3 {
+		return "", "", fmt.Errorf("can't parse owner and repo from remote URL %s", url)
+	}
+	return matches[1], matches[2], nil
+}
+
+func ParseBranch(r *git.Repository) (string, error) {
+	ref, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+	if !ref.Name().IsBranch() {
+		return "", fmt.Errorf("can't parse branch because git HEAD is not a branch")
+	}
+	return ref.Name().Short(), nil
+}
+
+// Returns when the commit at git HEAD was committed.
+func ParseHeadCommitTime(r *git.Repository) (time.Time, error) {
+	ref, err := r.Head()
+	if err != nil {
+		return time.Time{}, err
+	}
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return commit.Committer.When, nil
+}
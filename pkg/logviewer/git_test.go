@@ -0,0 +1,163 @@
+package logviewer
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRemoteOwnerAndRepo(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	cmd := exec.Command("git", "init", ".")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	cmd = exec.Command("git", "remote", "add", "origin", "https://github.com/Octogonapus/TerratestLogViewer.git")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	r, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+
+	owner, repo, err := ParseRemoteOwnerAndRepo(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "Octogonapus", owner)
+	assert.Equal(t, "TerratestLogViewer", repo)
+}
+
+func TestParseOwnerAndRepo(t *testing.T) {
+	t.Parallel()
+	for _, url := range []string{
+		"https://github.com/Octogonapus/TerratestLogViewer.git",
+		"https://github.com/Octogonapus/TerratestLogViewer",
+		"http://github.com/Octogonapus/TerratestLogViewer/",
+		"git@github.com:Octogonapus/TerratestLogViewer.git",
+		"ssh://git@github.com/Octogonapus/TerratestLogViewer.git",
+		"ssh://git@github.com:22/Octogonapus/TerratestLogViewer",
+		"git://github.com/Octogonapus/TerratestLogViewer.git",
+	} {
+		owner, repo, err := ParseOwnerAndRepo(url)
+		assert.NoError(t, err, url)
+		assert.Equal(t, "Octogonapus", owner, url)
+		assert.Equal(t, "TerratestLogViewer", repo, url)
+	}
+
+	owner, repo, err := ParseOwnerAndRepo("https://github.com/my-org/my.repo.git")
+	assert.NoError(t, err)
+	assert.Equal(t, "my-org", owner)
+	assert.Equal(t, "my.repo", repo)
+
+	for _, url := range []string{"", "not a url", "/home/me/repo", "https://github.com/Octogonapus"} {
+		_, _, err := ParseOwnerAndRepo(url)
+		assert.EqualError(t, err, "can't parse owner and repo from remote URL "+url)
+	}
+}
+
+func TestParseRemoteOwnerAndRepoPrefersOrigin(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	cmd := exec.Command("git", "init", ".")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	cmd = exec.Command("git", "remote", "add", "upstream", "https://github.com/Upstream/TerratestLogViewer.git")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	cmd = exec.Command("git", "remote", "add", "origin", "git@github.com:Octogonapus/TerratestLogViewer.git")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	r, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+
+	owner, repo, err := ParseRemoteOwnerAndRepo(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "Octogonapus", owner)
+	assert.Equal(t, "TerratestLogViewer", repo)
+
+	cmd = exec.Command("git", "remote", "rename", "origin", "fork")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	r, err = git.PlainOpen(dir)
+	assert.NoError(t, err)
+
+	_, _, err = ParseRemoteOwnerAndRepo(r)
+	assert.EqualError(t, err, "can't parse owner and repo with more than one remote and none named origin")
+}
+
+func TestParseBranch(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	cmd := exec.Command("git", "init", ".")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	cmd = exec.Command("git", "checkout", "-b", "myBranchName")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	cmd = exec.Command("git", "commit", "--allow-empty", "-m", "msg")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	r, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+
+	branch, err := ParseBranch(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "myBranchName", branch)
+}
+
+func TestParseHeadCommitTime(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	cmd := exec.Command("git", "init", ".")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	cmd = exec.Command("git", "commit", "--allow-empty", "-m", "msg")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_COMMITTER_DATE=2023-05-02T19:31:15Z")
+	assert.NoError(t, cmd.Run())
+
+	r, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+
+	committed, err := ParseHeadCommitTime(r)
+	assert.NoError(t, err)
+	assert.True(t, committed.Equal(time.Date(2023, 5, 2, 19, 31, 15, 0, time.UTC)), committed)
+}
+
+func TestParseBranchDetachedHead(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	cmd := exec.Command("git", "init", ".")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	cmd = exec.Command("git", "commit", "--allow-empty", "-m", "msg")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	cmd = exec.Command("git", "checkout", "--detach")
+	cmd.Dir = dir
+	assert.NoError(t, cmd.Run())
+
+	r, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+
+	_, err = ParseBranch(r)
+	assert.EqualError(t, err, "can't parse branch because git HEAD is not a branch")
+}
@@ -0,0 +1,957 @@
+package logviewer
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v52/github"
+)
+
+// A Client finds and downloads the logs of GitHub Actions jobs.
+type Client struct {
+	GitHub *github.Client
+	// Cache is where the logs of completed jobs are cached. Logs are not cached if Cache is nil.
+	Cache *LogCache
+	Retry RetryPolicy
+	// Logger logs each step of finding and downloading the logs if it is not nil.
+	Logger *log.Logger
+	// Progress is called as the logs are downloaded if it is not nil.
+	Progress ProgressFunc
+	// HTTPClient downloads the logs, e.g. through a proxy, or http.DefaultClient downloads them if it is nil.
+	// The logs are downloaded from blob storage rather than from the GitHub API, so it must not add GitHub credentials to its requests.
+	HTTPClient *http.Client
+}
+
+// Reports the number of bytes of the logs of a job downloaded so far, out of total, which is -1 if unknown.
+type ProgressFunc func(downloaded int64, total int64)
+
+// The parameters which select the logs to fetch.
+type FetchOptions struct {
+	Owner string
+	Repo  string
+	// Workflow is the filename of the workflow, e.g. test.yml. It is not used if RunID is set.
+	Workflow string
+	Branch   string
+	// HeadSHA restricts the runs to those for this commit if it is not empty.
+	HeadSHA string
+	// Status restricts the runs to those with this status, e.g. completed, if it is not empty and RunID is not set.
+	// A run which is not completed has incomplete logs.
+	Status string
+	// Conclusion restricts the runs to those which completed with this conclusion, e.g. failure, if it is not empty and RunID is not set.
+	Conclusion string
+	// RunID selects this run instead of the most recent matching run if it is not zero.
+	RunID int64
+	// Job is the name of the job within the run, or a path.Match pattern such as "test (*)" which must match exactly one job.
+	// If AllJobs is set, it selects the jobs to merge instead, or every job if it is empty.
+	Job string
+	// AllJobs merges the logs of every job in the run, each preceded by a separator line with the job's name.
+	AllJobs bool
+	// WholeRun merges the logs of every job in the run like AllJobs, but from the log archive of the run, which is downloaded
+	// in one request instead of one request per job. Job is not used, and the logs are not cached.
+	WholeRun bool
+}
+
+// Returns a reader of the logs selected by the given options, along with where they came from. The caller must close the reader.
+func (c *Client) Fetch(ctx context.Context, opts FetchOptions) (io.ReadCloser, LogSource, error) {
+	if opts.WholeRun {
+		return c.getWholeRunLogs(ctx, opts)
+	}
+	if opts.AllJobs {
+		return c.getAllJobLogs(ctx, opts)
+	}
+	return c.getLogs(ctx, opts)
+}
+
+// Returns a reader of the logs selected by the given options like Fetch, but from the most recent of up to maxRuns matching runs
+// whose logs contain a line logged by a selected test, e.g. to skip recent runs in which the test did not run.
+// The logs of each run which is searched are read into memory. The caller must close the reader.
+// The timestamps of the logs must parse using the given layout, or RFC 3339 if it is empty.
+func (c *Client) FetchWithTest(ctx context.Context, opts FetchOptions, maxRuns int, matchesTest TestMatcher, layout string) (io.ReadCloser, LogSource, error) {
+	runs, err := findRuns(ctx, c.GitHub, opts, maxRuns)
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("finding the workflow runs", DescribeRateLimit(err))
+	}
+	for i, run := range runs {
+		logf(c.Logger, "searching run #%d (id %d) for the selected tests", run.GetRunNumber(), run.GetID())
+		var logs io.ReadCloser
+		var source LogSource
+		if opts.WholeRun {
+			logs, source, err = c.getRunArchiveLogs(ctx, opts.Owner, opts.Repo, run)
+		} else if opts.AllJobs {
+			logs, source, err = c.getAllRunJobLogs(ctx, opts, run)
+		} else {
+			logs, source, err = c.getRunLogs(ctx, opts, run)
+		}
+		if err != nil {
+			return nil, LogSource{}, err
+		}
+		data, err := io.ReadAll(logs)
+		logs.Close()
+		if err != nil {
+			return nil, LogSource{}, DescribeTimeout("downloading the logs", err)
+		}
+
+		err = forEachLine(bytes.NewReader(data), func(line []byte) error {
+			if matchesTest(line, startOfMessage(line, layout)) != nil {
+				return errTestFound
+			}
+			return nil
+		})
+		if errors.Is(err, errTestFound) {
+			source.RunsSkipped = i
+			return io.NopCloser(bytes.NewReader(data)), source, nil
+		}
+	}
+	return nil, LogSource{}, kindError{kind: ErrNoRuns, err: fmt.Errorf("none of the latest %d runs logged the selected tests", len(runs))}
+}
+
+// Returns a reader of the logs selected by the given options like FetchWithTest, but searches the repositories of the organization
+// Owner instead of only Repo, e.g. when it is not known which repository ran the test. Up to maxRepos of the most recently pushed
+// repositories which are not archived are searched in turn, and up to maxRuns runs of Workflow in each, on Branch or on the
+// default branch of each repository if Branch is empty. Repositories without the workflow, a matching run, or a matching job are skipped.
+// Each repository searched costs several API requests, so maxRepos should be kept small. The caller must close the reader.
+func (c *Client) SearchOrg(ctx context.Context, opts FetchOptions, maxRepos int, maxRuns int, matchesTest TestMatcher, layout string) (io.ReadCloser, LogSource, error) {
+	repos, err := listOrgRepos(ctx, c.GitHub, opts.Owner, maxRepos)
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("listing the repositories", DescribeRateLimit(err))
+	}
+	for _, repo := range repos {
+		repoOpts := opts
+		repoOpts.Repo = repo.GetName()
+		if len(repoOpts.Branch) == 0 {
+			repoOpts.Branch = repo.GetDefaultBranch()
+		}
+		logf(c.Logger, "searching %s for the selected tests", repo.GetFullName())
+		logs, source, err := c.FetchWithTest(ctx, repoOpts, maxRuns, matchesTest, layout)
+		var apiErr *github.ErrorResponse
+		if errors.Is(err, ErrNoRuns) || errors.Is(err, ErrJobNotFound) || (errors.As(err, &apiErr) && apiErr.Response.StatusCode == http.StatusNotFound) {
+			logf(c.Logger, "skipping %s: %s", repo.GetFullName(), err)
+			continue
+		}
+		if err != nil {
+			return nil, LogSource{}, err
+		}
+		source.Repo = repoOpts.Repo
+		return logs, source, nil
+	}
+	return nil, LogSource{}, kindError{kind: ErrNoRuns, err: fmt.Errorf("none of the latest %d repositories of %s has a run of workflow %s which logged the selected tests", len(repos), opts.Owner, opts.Workflow)}
+}
+
+// Returns a reader which follows the logs of the job selected by the given options as the job runs, along with where they come from.
+// The job's status is polled every interval, and the lines appended to its logs since the previous poll are read as they appear.
+// The reader ends once the job has completed and the rest of its logs have been read. The caller must close the reader.
+// GitHub only serves the logs of a job once they have been uploaded, which may only be after some or all of its steps
+// have finished, so new lines can arrive in large batches and a poll before any logs are available reads nothing.
+// Merging the logs of several jobs with AllJobs is not supported.
+func (c *Client) Watch(ctx context.Context, opts FetchOptions, interval time.Duration) (io.ReadCloser, LogSource, error) {
+	run, err := findRun(ctx, c.GitHub, opts)
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("finding the workflow run", DescribeRateLimit(err))
+	}
+	logf(c.Logger, "selected run #%d (id %d) for commit %s", run.GetRunNumber(), run.GetID(), run.GetHeadSHA())
+	job, err := findJob(ctx, c.GitHub, opts.Owner, opts.Repo, run.GetID(), opts.Job)
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("finding the job", DescribeRateLimit(err))
+	}
+	logf(c.Logger, "watching job '%s' (id %d)", job.GetName(), job.GetID())
+	logs := &watchReader{ctx: ctx, interval: interval, poll: func() ([]byte, bool, error) {
+		return c.pollJobLogs(ctx, opts.Owner, opts.Repo, job.GetID())
+	}}
+	return logs, LogSource{Run: run, Job: job}, nil
+}
+
+// Returns all of the logs of the given job so far, and whether the job has completed so that they are its full logs.
+// The logs of a job which has not completed may not be available yet, in which case there are no logs so far.
+func (c *Client) pollJobLogs(ctx context.Context, owner string, repo string, jobID int64) ([]byte, bool, error) {
+	// the status is checked before the download so that the logs of a completed job are complete
+	job, _, err := c.GitHub.Actions.GetWorkflowJobByID(ctx, owner, repo, jobID)
+	if err != nil {
+		return nil, false, DescribeTimeout("checking the job status", DescribeRateLimit(err))
+	}
+	completed := job.GetStatus() == "completed"
+	logf(c.Logger, "job %d is %s", jobID, job.GetStatus())
+
+	logsURL, _, err := c.GitHub.Actions.GetWorkflowJobLogs(ctx, owner, repo, jobID, false)
+	if err == nil {
+		logs, downloadErr := downloadLogs(ctx, logsURL.String(), c.Retry, c.HTTPClient, nil)
+		if downloadErr == nil {
+			defer logs.Close()
+			data, readErr := io.ReadAll(logs)
+			if readErr == nil {
+				return data, completed, nil
+			}
+			err = readErr
+		} else {
+			err = downloadErr
+		}
+	}
+	if completed {
+		return nil, false, DescribeTimeout("downloading the logs", DescribeRateLimit(err))
+	}
+	logf(c.Logger, "the logs of job %d are not available yet: %s", jobID, err)
+	return nil, false, nil
+}
+
+// An io.ReadCloser which polls for the logs of a job and reads the part of them which follows what was read by the previous poll,
+// until a poll finds the job has completed.
+type watchReader struct {
+	ctx      context.Context
+	interval time.Duration
+	poll     func() ([]byte, bool, error)
+	// the number of bytes of the logs which have been polled so far
+	offset  int
+	pending []byte
+	polled  bool
+	done    bool
+}
+
+func (w *watchReader) Read(p []byte) (int, error) {
+	for len(w.pending) == 0 {
+		if w.done {
+			return 0, io.EOF
+		}
+		if w.polled {
+			select {
+			case <-time.After(w.interval):
+			case <-w.ctx.Done():
+				return 0, w.ctx.Err()
+			}
+		}
+		logs, done, err := w.poll()
+		if err != nil {
+			return 0, err
+		}
+		w.polled = true
+		w.done = done
+		// the logs only grow as the job runs, so the new lines are those after the previous logs
+		if len(logs) > w.offset {
+			w.pending = logs[w.offset:]
+			w.offset = len(logs)
+		}
+	}
+	n := copy(p, w.pending)
+	w.pending = w.pending[n:]
+	return n, nil
+}
+
+func (w *watchReader) Close() error {
+	return nil
+}
+
+// Stops searching logs once a selected test is found.
+var errTestFound = errors.New("found test")
+
+// The kinds of errors of finding and downloading the logs, which the errors wrap so that callers can tell them apart with errors.Is.
+var (
+	// ErrNoRuns is wrapped by the errors of finding no workflow run matching the options.
+	ErrNoRuns = errors.New("no matching workflow run")
+	// ErrJobNotFound is wrapped by the errors of finding no job, or more than one job, matching the job name or pattern.
+	ErrJobNotFound = errors.New("no matching job")
+	// ErrLogsExpired is wrapped by the errors of finding the logs of a job or run which GitHub has deleted after the retention period.
+	ErrLogsExpired = errors.New("logs have expired")
+	// ErrDownload is wrapped by the errors of downloading the logs once they were found.
+	ErrDownload = errors.New("failed to download logs")
+)
+
+// An error with the message of err, which also wraps kind, e.g. ErrNoRuns.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// Returns the workflow run selected by the given options like FindRun, once a run created after the given time is selected.
+// GitHub may list a run some time after it was triggered, e.g. by a push, and list only older runs or none until then,
+// so the runs are listed again every interval until ctx is done. Errors returned by the GitHub API are not retried.
+func (c *Client) WaitForRun(ctx context.Context, opts FetchOptions, after time.Time, interval time.Duration) (*github.WorkflowRun, error) {
+	// why the previous attempt did not select a run, which is more useful than the error of a request cut short by ctx
+	var reason error
+	for {
+		run, err := findRun(ctx, c.GitHub, opts)
+		var apiErr *github.ErrorResponse
+		var rateLimitErr *github.RateLimitError
+		if errors.As(err, &apiErr) || errors.As(err, &rateLimitErr) {
+			return nil, err
+		}
+		if err == nil && run.GetCreatedAt().After(after) {
+			return run, nil
+		}
+		if ctx.Err() == nil {
+			reason = err
+			if err == nil {
+				reason = fmt.Errorf("the latest run #%d (id %d) was created at %s", run.GetRunNumber(), run.GetID(), run.GetCreatedAt().Format(time.RFC3339))
+			}
+			logf(c.Logger, "waiting for a run created after %s: %s", after.Format(time.RFC3339), reason)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			if reason == nil {
+				reason = ctx.Err()
+			}
+			return nil, kindError{kind: ErrNoRuns, err: fmt.Errorf("timed out waiting for a run created after %s: %w", after.Format(time.RFC3339), reason)}
+		}
+	}
+}
+
+// Returns the workflow run selected by the given options. The job options are not used.
+func (c *Client) FindRun(ctx context.Context, opts FetchOptions) (*github.WorkflowRun, error) {
+	return findRun(ctx, c.GitHub, opts)
+}
+
+// Returns the job with the given name in the given workflow run.
+func (c *Client) FindJob(ctx context.Context, owner string, repo string, runID int64, jobName string) (*github.WorkflowJob, error) {
+	return findJob(ctx, c.GitHub, owner, repo, runID, jobName)
+}
+
+// Returns up to maxRepos of the repositories of the given organization which are not archived, most recently pushed first.
+func listOrgRepos(ctx context.Context, gh *github.Client, org string, maxRepos int) ([]*github.Repository, error) {
+	repos := []*github.Repository{}
+	opts := &github.RepositoryListByOrgOptions{Sort: "pushed", Direction: "desc", ListOptions: github.ListOptions{PerPage: minInt(maxRepos, 100)}}
+	for {
+		page, resp, err := gh.Repositories.ListByOrg(ctx, org, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the repositories of %s: %w", org, err)
+		}
+		for _, repo := range page {
+			// archived repositories cannot run workflows
+			if repo.GetArchived() {
+				continue
+			}
+			repos = append(repos, repo)
+			if len(repos) == maxRepos {
+				return repos, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// Returns every job in the given workflow run.
+func (c *Client) ListJobs(ctx context.Context, owner string, repo string, runID int64) ([]*github.WorkflowJob, error) {
+	return listJobs(ctx, c.GitHub, owner, repo, runID)
+}
+
+// Returns the open pull request whose head is the given branch of the given repository, or nil if there is none.
+func (c *Client) FindOpenPullRequest(ctx context.Context, owner string, repo string, branch string) (*github.PullRequest, error) {
+	return findOpenPullRequest(ctx, c.GitHub, owner, repo, branch)
+}
+
+// Returns the open pull request whose head is the given branch of the given repository, or nil if there is none.
+func findOpenPullRequest(ctx context.Context, gh *github.Client, owner string, repo string, branch string) (*github.PullRequest, error) {
+	prs, _, err := gh.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{State: "open", Head: owner + ":" + branch})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests for branch %s: %w", branch, err)
+	}
+	if len(prs) == 0 {
+		return nil, nil
+	}
+	return prs[0], nil
+}
+
+// Describes the workflow run and job which logs were downloaded from.
+type LogSource struct {
+	Run *github.WorkflowRun
+	// Job is nil if the logs of every job in the run were read.
+	Job *github.WorkflowJob
+	// Cached is whether the logs were read from the cache instead of downloaded.
+	Cached bool
+	// RunsSkipped is the number of more recent runs skipped by FetchWithTest because they did not log a selected test.
+	RunsSkipped int
+	// Repo is the repository which SearchOrg found the logs in, or empty if they were not found by SearchOrg.
+	Repo string
+}
+
+// Returns the workflow run with the RunID of the given options if it is not zero, otherwise the most recent run matching the options.
+func findRun(ctx context.Context, gh *github.Client, opts FetchOptions) (*github.WorkflowRun, error) {
+	runs, err := findRuns(ctx, gh, opts, 1)
+	if err != nil {
+		return nil, err
+	}
+	return runs[0], nil
+}
+
+// Returns the run found by findRun, which is read from the cache if it was found recently.
+// A run selected by its ID or commit is always looked up, as is every run if the Client has no Cache.
+func (c *Client) findCachedRun(ctx context.Context, opts FetchOptions) (*github.WorkflowRun, error) {
+	if c.Cache == nil || opts.RunID != 0 || len(opts.HeadSHA) > 0 {
+		return findRun(ctx, c.GitHub, opts)
+	}
+	key := strings.Join([]string{"run", opts.Workflow, opts.Branch, opts.Status, opts.Conclusion}, "\x00")
+	run := &github.WorkflowRun{}
+	if c.Cache.loadResolved(c.GitHub.BaseURL.Host, opts.Owner, opts.Repo, key, run) {
+		logf(c.Logger, "cache hit for the latest run of %s on %s", opts.Workflow, opts.Branch)
+		return run, nil
+	}
+	run, err := findRun(ctx, c.GitHub, opts)
+	if err != nil {
+		return nil, err
+	}
+	// a run which is not completed yet changes as it runs, so only completed runs are cached
+	if run.GetStatus() == "completed" {
+		c.Cache.storeResolved(c.GitHub.BaseURL.Host, opts.Owner, opts.Repo, key, run)
+	}
+	return run, nil
+}
+
+// Returns the workflow run with the RunID of the given options if it is not zero, otherwise up to maxRuns of the most recent runs of
+// Workflow on Branch, most recent first. The job options are not used.
+// If HeadSHA is not empty, only runs for that commit are considered.
+// If Status is not empty, only runs with that status are considered, e.g. completed to skip runs which are still in progress.
+// If Conclusion is not empty, only runs with that conclusion are considered, e.g. failure to find the latest failed run.
+func findRuns(ctx context.Context, gh *github.Client, opts FetchOptions, maxRuns int) ([]*github.WorkflowRun, error) {
+	if opts.RunID != 0 {
+		run, resp, err := gh.Actions.GetWorkflowRunByID(ctx, opts.Owner, opts.Repo, opts.RunID)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, kindError{kind: ErrNoRuns, err: fmt.Errorf("run %d does not belong to %s/%s", opts.RunID, opts.Owner, opts.Repo)}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []*github.WorkflowRun{run}, nil
+	}
+
+	listOpts := &github.ListWorkflowRunsOptions{Branch: opts.Branch, HeadSHA: opts.HeadSHA, ListOptions: github.ListOptions{PerPage: 100}}
+	if len(opts.HeadSHA) > 0 {
+		// the head SHA already identifies the run, and runs for pull requests from forks are not on a branch in this repository
+		listOpts.Branch = ""
+	}
+	// the workflow is also accepted as a path such as .github/workflows/test.yml
+	filename, _ := NormalizeWorkflowFilename(opts.Workflow)
+	// the runs are listed from the most recent, so the first matching run is the latest
+	matches := []*github.WorkflowRun{}
+	for {
+		runs, resp, err := gh.Actions.ListWorkflowRunsByFileName(ctx, opts.Owner, opts.Repo, filename, listOpts)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range runs.WorkflowRuns {
+			if (len(opts.Status) == 0 || run.GetStatus() == opts.Status) && (len(opts.Conclusion) == 0 || run.GetConclusion() == opts.Conclusion) {
+				matches = append(matches, run)
+				if len(matches) == maxRuns {
+					return matches, nil
+				}
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+	if len(matches) > 0 {
+		return matches, nil
+	}
+
+	description := "workflow runs"
+	if len(opts.Status) > 0 {
+		description = opts.Status + " workflow runs"
+	}
+	if len(opts.Conclusion) > 0 {
+		description += " with conclusion " + opts.Conclusion
+	}
+	if len(opts.HeadSHA) > 0 {
+		return nil, kindError{kind: ErrNoRuns, err: fmt.Errorf("no %s found for commit %s and workflow %s", description, opts.HeadSHA, opts.Workflow)}
+	}
+	return nil, kindError{kind: ErrNoRuns, err: fmt.Errorf("no %s found for branch %s and workflow %s", description, opts.Branch, opts.Workflow)}
+}
+
+// Returns the job with the given name or name pattern in the given workflow run, searching every page of the run's jobs.
+func findJob(ctx context.Context, gh *github.Client, owner string, repo string, runID int64, jobName string) (*github.WorkflowJob, error) {
+	jobs, err := listJobs(ctx, gh, owner, repo, runID)
+	if err != nil {
+		return nil, err
+	}
+	return jobNamed(jobs, jobName)
+}
+
+// Returns the one job among the given jobs whose name matches the given name or path.Match pattern, e.g. "test (*)".
+func jobNamed(jobs []*github.WorkflowJob, jobName string) (*github.WorkflowJob, error) {
+	matches, err := MatchJobs(jobs, jobName)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, kindError{kind: ErrJobNotFound, err: errors.New("did not find matching job")}
+	} else if len(matches) > 1 {
+		names := make([]string, len(matches))
+		for i, job := range matches {
+			names[i] = job.GetName()
+		}
+		return nil, kindError{kind: ErrJobNotFound, err: fmt.Errorf("job %s matches %d jobs, specify one of them or read them all via --all-jobs: %s", jobName, len(matches), strings.Join(names, ", "))}
+	}
+	return matches[0], nil
+}
+
+// Returns the jobs among the given jobs whose names match the given path.Match pattern, in their original order.
+// A name without wildcards matches only itself.
+func MatchJobs(jobs []*github.WorkflowJob, pattern string) ([]*github.WorkflowJob, error) {
+	matches := []*github.WorkflowJob{}
+	for _, job := range jobs {
+		ok, err := path.Match(pattern, job.GetName())
+		if err != nil {
+			return nil, fmt.Errorf("invalid job pattern %s: %w", pattern, err)
+		}
+		if ok {
+			matches = append(matches, job)
+		}
+	}
+	return matches, nil
+}
+
+// Returns every job in the given workflow run.
+func listJobs(ctx context.Context, gh *github.Client, owner string, repo string, runID int64) ([]*github.WorkflowJob, error) {
+	allJobs := []*github.WorkflowJob{}
+	opts := &github.ListWorkflowJobsOptions{}
+	for {
+		jobs, resp, err := gh.Actions.ListWorkflowJobs(ctx, owner, repo, runID, opts)
+		if err != nil {
+			return nil, err
+		}
+		allJobs = append(allJobs, jobs.Jobs...)
+
+		if resp.NextPage == 0 {
+			return allJobs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// Returns a reader of the log for the job selected by the given options, along with where it came from.
+// The job is taken from the run found by findCachedRun. The caller must close the reader.
+func (c *Client) getLogs(ctx context.Context, opts FetchOptions) (io.ReadCloser, LogSource, error) {
+	latestRun, err := c.findCachedRun(ctx, opts)
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("finding the workflow run", DescribeRateLimit(err))
+	}
+	logf(c.Logger, "selected run #%d (id %d) for commit %s", latestRun.GetRunNumber(), latestRun.GetID(), latestRun.GetHeadSHA())
+	return c.getRunLogs(ctx, opts, latestRun)
+}
+
+// Returns a reader of the log for the job with the name or name pattern Job of the given options in the given run, along with
+// where it came from. The caller must close the reader.
+func (c *Client) getRunLogs(ctx context.Context, opts FetchOptions, run *github.WorkflowRun) (io.ReadCloser, LogSource, error) {
+	matchingJob, err := c.findCachedJob(ctx, opts.Owner, opts.Repo, run.GetID(), opts.Job)
+	if err != nil {
+		return nil, LogSource{}, err
+	}
+	logf(c.Logger, "matched job '%s' (id %d)", matchingJob.GetName(), matchingJob.GetID())
+
+	logs, cached, err := c.getJobLogs(ctx, opts.Owner, opts.Repo, run, matchingJob)
+	if err != nil {
+		return nil, LogSource{}, err
+	}
+	return logs, LogSource{Run: run, Job: matchingJob, Cached: cached}, nil
+}
+
+// Returns the job with the given name or name pattern in the given run, which is read from the cache if it was found recently.
+func (c *Client) findCachedJob(ctx context.Context, owner string, repo string, runID int64, jobName string) (*github.WorkflowJob, error) {
+	key := strings.Join([]string{"job", strconv.FormatInt(runID, 10), jobName}, "\x00")
+	job := &github.WorkflowJob{}
+	if c.Cache != nil && c.Cache.loadResolved(c.GitHub.BaseURL.Host, owner, repo, key, job) {
+		logf(c.Logger, "cache hit for job '%s' in run %d", jobName, runID)
+		return job, nil
+	}
+	jobs, err := listJobs(ctx, c.GitHub, owner, repo, runID)
+	if err != nil {
+		return nil, DescribeTimeout("finding the job", DescribeRateLimit(err))
+	}
+	logf(c.Logger, "listed %d jobs in run %d", len(jobs), runID)
+	job, err = jobNamed(jobs, jobName)
+	if err != nil {
+		return nil, err
+	}
+	// like its logs, a job which is not completed yet is not cached
+	if c.Cache != nil && job.GetStatus() == "completed" {
+		c.Cache.storeResolved(c.GitHub.BaseURL.Host, owner, repo, key, job)
+	}
+	return job, nil
+}
+
+// Returns a reader of the logs of every job in the run found by findCachedRun, or of the jobs matching Job, like getAllRunJobLogs.
+func (c *Client) getAllJobLogs(ctx context.Context, opts FetchOptions) (io.ReadCloser, LogSource, error) {
+	latestRun, err := c.findCachedRun(ctx, opts)
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("finding the workflow run", DescribeRateLimit(err))
+	}
+	logf(c.Logger, "selected run #%d (id %d) for commit %s", latestRun.GetRunNumber(), latestRun.GetID(), latestRun.GetHeadSHA())
+	return c.getAllRunJobLogs(ctx, opts, latestRun)
+}
+
+// Returns a reader of the logs of every job in the given run, or of the jobs matching the pattern Job of the given options if it is
+// not empty, one after the other, along with where they came from. The logs of each job are preceded by a separator line with the
+// job's name. The caller must close the reader.
+func (c *Client) getAllRunJobLogs(ctx context.Context, opts FetchOptions, run *github.WorkflowRun) (io.ReadCloser, LogSource, error) {
+	jobs, err := listJobs(ctx, c.GitHub, opts.Owner, opts.Repo, run.GetID())
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("listing the jobs", DescribeRateLimit(err))
+	}
+	logf(c.Logger, "listed %d jobs in run %d", len(jobs), run.GetID())
+	if len(opts.Job) > 0 {
+		jobs, err = MatchJobs(jobs, opts.Job)
+		if err != nil {
+			return nil, LogSource{}, err
+		}
+		if len(jobs) == 0 {
+			return nil, LogSource{}, kindError{kind: ErrJobNotFound, err: errors.New("did not find matching job")}
+		}
+		logf(c.Logger, "matched %d jobs with '%s'", len(jobs), opts.Job)
+	}
+
+	logs := &jobsReader{jobs: jobs, open: func(job *github.WorkflowJob) (io.ReadCloser, error) {
+		logs, _, err := c.getJobLogs(ctx, opts.Owner, opts.Repo, run, job)
+		return logs, err
+	}}
+	return logs, LogSource{Run: run}, nil
+}
+
+// Returns a reader of the logs of every job in the run found by findCachedRun, read from the run's log archive like getRunArchiveLogs.
+func (c *Client) getWholeRunLogs(ctx context.Context, opts FetchOptions) (io.ReadCloser, LogSource, error) {
+	latestRun, err := c.findCachedRun(ctx, opts)
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("finding the workflow run", DescribeRateLimit(err))
+	}
+	logf(c.Logger, "selected run #%d (id %d) for commit %s", latestRun.GetRunNumber(), latestRun.GetID(), latestRun.GetHeadSHA())
+	return c.getRunArchiveLogs(ctx, opts.Owner, opts.Repo, latestRun)
+}
+
+// Returns a reader of the logs of every job in the given run, one after the other, along with where they came from.
+// The run's log archive is downloaded and unzipped in memory, and the logs of each job are preceded by a separator line with the job's name.
+// The caller must close the reader.
+func (c *Client) getRunArchiveLogs(ctx context.Context, owner string, repo string, run *github.WorkflowRun) (io.ReadCloser, LogSource, error) {
+	_, logsGHResp, err := c.GitHub.Actions.GetWorkflowRunLogs(ctx, owner, repo, run.GetID(), false)
+	if err != nil && logsGHResp != nil && logsGHResp.StatusCode == http.StatusGone {
+		return nil, LogSource{}, kindError{kind: ErrLogsExpired, err: fmt.Errorf("logs for run #%d have expired (older than the retention period): %w", run.GetRunNumber(), err)}
+	}
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("finding the run logs", DescribeRateLimit(err))
+	}
+
+	logsURL := logsGHResp.Header.Get("Location")
+	if parsedURL, err := url.Parse(logsURL); err == nil {
+		logf(c.Logger, "downloading the log archive of run %d from %s", run.GetID(), parsedURL.Host)
+	}
+	logsBody, err := downloadLogs(ctx, logsURL, c.Retry, c.HTTPClient, c.Progress)
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("downloading the logs", err)
+	}
+	defer logsBody.Close()
+	// a zip archive is read from its end, so it cannot be streamed
+	archive, err := io.ReadAll(logsBody)
+	if err != nil {
+		return nil, LogSource{}, DescribeTimeout("downloading the logs", err)
+	}
+
+	logs, err := readRunArchive(archive)
+	if err != nil {
+		return nil, LogSource{}, err
+	}
+	return io.NopCloser(bytes.NewReader(logs)), LogSource{Run: run}, nil
+}
+
+// Returns the logs of every job in the given log archive of a run, each preceded by the jobSeparator of its name.
+// The archive has a file of the logs of each job at its root, e.g. 0_test.txt, in the order the jobs ran, and a directory
+// of the logs of each step of each job, which are the same lines again and are skipped.
+func readRunArchive(archive []byte) ([]byte, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the log archive: %w", err)
+	}
+
+	type jobFile struct {
+		index int
+		name  string
+		file  *zip.File
+	}
+	files := []jobFile{}
+	for _, file := range zipReader.File {
+		if strings.Contains(file.Name, "/") || !strings.HasSuffix(file.Name, ".txt") {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name, ".txt")
+		index := len(zipReader.File)
+		if prefix, rest, ok := strings.Cut(name, "_"); ok {
+			if parsed, err := strconv.Atoi(prefix); err == nil {
+				index = parsed
+				name = rest
+			}
+		}
+		files = append(files, jobFile{index: index, name: name, file: file})
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].index < files[j].index })
+
+	logs := []byte{}
+	for _, file := range files {
+		if len(logs) > 0 && logs[len(logs)-1] != '\n' {
+			logs = append(logs, '\n')
+		}
+		logs = append(logs, jobNameSeparator(file.name)...)
+		content, err := file.file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from the log archive: %w", file.file.Name, err)
+		}
+		data, err := io.ReadAll(content)
+		content.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from the log archive: %w", file.file.Name, err)
+		}
+		logs = append(logs, data...)
+	}
+	return logs, nil
+}
+
+// Returns a reader of the logs of the given job in the given run, and whether they were read from the cache. The caller must close the reader.
+func (c *Client) getJobLogs(ctx context.Context, owner string, repo string, run *github.WorkflowRun, job *github.WorkflowJob) (io.ReadCloser, bool, error) {
+	cache := c.Cache
+	// the logs of a job which is still running are incomplete, so they are neither read from nor saved to the cache
+	if job.GetStatus() != "completed" {
+		logf(c.Logger, "not caching the logs of job %d as its status is %s", job.GetID(), job.GetStatus())
+		cache = nil
+	}
+	host := c.GitHub.BaseURL.Host
+	if cache != nil {
+		cachedLogs, ok, err := cache.open(host, owner, repo, run.GetID(), job.GetID())
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			logf(c.Logger, "cache hit for job %d at %s", job.GetID(), cache.path(host, owner, repo, run.GetID(), job.GetID()))
+			return cachedLogs, true, nil
+		}
+		logf(c.Logger, "cache miss for job %d", job.GetID())
+	}
+
+	_, logsGHResp, err := c.GitHub.Actions.GetWorkflowJobLogs(ctx, owner, repo, job.GetID(), false)
+	// GitHub deletes logs once they are older than the repository's retention period, which is 90 days by default
+	if err != nil && logsGHResp != nil && logsGHResp.StatusCode == http.StatusGone {
+		return nil, false, kindError{kind: ErrLogsExpired, err: fmt.Errorf("logs for run #%d have expired (older than the retention period): %w", run.GetRunNumber(), err)}
+	}
+	if err != nil {
+		return nil, false, DescribeTimeout("finding the job logs", DescribeRateLimit(err))
+	}
+
+	logsURL := logsGHResp.Header.Get("Location")
+	if parsedURL, err := url.Parse(logsURL); err == nil {
+		logf(c.Logger, "downloading the logs of job %d from %s", job.GetID(), parsedURL.Host)
+	}
+	logsBody, err := downloadLogs(ctx, logsURL, c.Retry, c.HTTPClient, c.Progress)
+	if err != nil {
+		return nil, false, DescribeTimeout("downloading the logs", err)
+	}
+
+	if cache != nil {
+		cachingLogs, err := cache.store(host, owner, repo, run.GetID(), job.GetID(), logsBody)
+		if err != nil {
+			logsBody.Close()
+			return nil, false, err
+		}
+		return cachingLogs, false, nil
+	}
+	return logsBody, false, nil
+}
+
+// The separator line which precedes the logs of each job when the logs of several jobs are merged.
+func jobSeparator(job *github.WorkflowJob) string {
+	return jobNameSeparator(job.GetName())
+}
+
+// The separator line which precedes the logs of a job with the given name when the logs of several jobs are merged.
+func jobNameSeparator(name string) string {
+	return fmt.Sprintf("===== job: %s =====\n", name)
+}
+
+// Returns whether the given line is the separator line of a job from jobNameSeparator.
+func isJobSeparator(line []byte) bool {
+	content, _ := bytes.CutSuffix(line, []byte("\n"))
+	return bytes.HasPrefix(content, []byte("===== job: ")) && bytes.HasSuffix(content, []byte(" ====="))
+}
+
+// An io.ReadCloser which reads the logs of each job in turn, each preceded by its jobSeparator.
+// The logs of a job are only opened once the logs of the jobs before it have been read in full.
+type jobsReader struct {
+	jobs    []*github.WorkflowJob
+	open    func(job *github.WorkflowJob) (io.ReadCloser, error)
+	current io.Reader
+	logs    io.ReadCloser
+	// whether the last byte read was a newline, so that each separator starts on its own line
+	atLineStart bool
+}
+
+func (j *jobsReader) Read(p []byte) (int, error) {
+	for {
+		if j.current == nil {
+			if len(j.jobs) == 0 {
+				return 0, io.EOF
+			}
+			job := j.jobs[0]
+			j.jobs = j.jobs[1:]
+			logs, err := j.open(job)
+			if err != nil {
+				return 0, err
+			}
+			separator := jobSeparator(job)
+			if j.logs != nil && !j.atLineStart {
+				separator = "\n" + separator
+			}
+			j.logs = logs
+			j.current = io.MultiReader(strings.NewReader(separator), logs)
+		}
+
+		n, err := j.current.Read(p)
+		if n > 0 {
+			j.atLineStart = p[n-1] == '\n'
+		}
+		if err == io.EOF {
+			// the logs are closed as soon as they are read so that a cached job is saved before the next job is downloaded
+			if closeErr := j.logs.Close(); closeErr != nil {
+				return n, closeErr
+			}
+			j.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (j *jobsReader) Close() error {
+	if j.current != nil {
+		j.current = nil
+		return j.logs.Close()
+	}
+	return nil
+}
+
+// Logs the given message to logger if it is not nil.
+func logf(logger *log.Logger, format string, args ...any) {
+	if logger != nil {
+		logger.Printf(format, args...)
+	}
+}
+
+// The rate limit of unauthenticated requests to the GitHub API, per hour. Authenticated requests have a higher limit.
+const unauthenticatedRateLimit = 60
+
+// Returns the given error with when the rate limit resets if it is a GitHub API rate limit error, otherwise returns it unchanged.
+// If the request was unauthenticated, setting a token is suggested to get a higher rate limit.
+func DescribeRateLimit(err error) error {
+	var rateLimitErr *github.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		return err
+	}
+	reset := rateLimitErr.Rate.Reset.Local().Format(time.RFC1123)
+	// the error of a request which go-github skipped because the limit was already exceeded has the request without its
+	// Authorization header, which is set by the transport, so the limit also tells whether the requests are authenticated
+	authenticated := rateLimitErr.Rate.Limit > unauthenticatedRateLimit
+	if resp := rateLimitErr.Response; resp != nil && resp.Request != nil && len(resp.Request.Header.Get("Authorization")) > 0 {
+		authenticated = true
+	}
+	if authenticated {
+		return fmt.Errorf("GitHub API rate limit exceeded, it resets at %s: %w", reset, err)
+	}
+	return fmt.Errorf("GitHub API rate limit exceeded, it resets at %s. Set GITHUB_TOKEN to get a higher rate limit: %w", reset, err)
+}
+
+// Returns the given error with the operation which timed out if it is a timeout, otherwise returns it unchanged.
+func DescribeTimeout(operation string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out %s, increase the timeout via --timeout: %w", operation, err)
+	}
+	return err
+}
+
+// Controls how many times, and how quickly, a failed log download is retried.
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+}
+
+// Returns a reader of the content at the given URL. The caller must close the reader.
+// Server and network errors while connecting are retried with exponential backoff according to the given policy.
+// Client errors are not retried.
+func downloadLogs(ctx context.Context, url string, retry RetryPolicy, httpClient *http.Client, progress ProgressFunc) (io.ReadCloser, error) {
+	for attempt := 1; ; attempt++ {
+		body, retryable, err := openLogs(ctx, url, httpClient, progress)
+		if err == nil {
+			return body, nil
+		}
+		if !retryable || attempt >= retry.Attempts {
+			return nil, kindError{kind: ErrDownload, err: fmt.Errorf("failed to download logs after %d attempt(s): %w", attempt, err)}
+		}
+		select {
+		case <-time.After(retry.BaseDelay * time.Duration(1<<(attempt-1))):
+		case <-ctx.Done():
+			return nil, kindError{kind: ErrDownload, err: fmt.Errorf("failed to download logs after %d attempt(s): %w", attempt, ctx.Err())}
+		}
+	}
+}
+
+// Returns a reader of the content at the given URL, or an error and whether the request is worth retrying.
+// If progress is not nil, it is called with the number of bytes read after each read.
+func openLogs(ctx context.Context, url string, httpClient *http.Client, progress ProgressFunc) (io.ReadCloser, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// a request which timed out would time out again
+		return nil, ctx.Err() == nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, resp.StatusCode >= 500, fmt.Errorf("unexpected status code: %s", resp.Status)
+	}
+
+	if progress != nil {
+		return &progressReader{ReadCloser: resp.Body, total: resp.ContentLength, progress: progress}, false, nil
+	}
+	return resp.Body, false, nil
+}
+
+// An io.ReadCloser which reports the number of bytes read from it out of total.
+type progressReader struct {
+	io.ReadCloser
+	downloaded int64
+	total      int64
+	progress   ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.downloaded += int64(n)
+		r.progress(r.downloaded, r.total)
+	}
+	return n, err
+}
@@ -0,0 +1,744 @@
+package logviewer
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v52/github"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// basic test to check it does not crash. hard to test much else
+func TestGetLogs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")})
+	tc := oauth2.NewClient(ctx, ts)
+	client := &Client{GitHub: github.NewClient(tc), Retry: RetryPolicy{Attempts: 3, BaseDelay: time.Second}}
+	body, _, err := client.getLogs(context.Background(), FetchOptions{Owner: "Octogonapus", Repo: "TerratestLogViewer", Workflow: "test.yml", Branch: "main", Job: "test"})
+	assert.NoError(t, err)
+	if err == nil {
+		defer body.Close()
+		logs, err := io.ReadAll(body)
+		assert.NotEmpty(t, logs)
+		assert.NoError(t, err)
+	}
+}
+
+// Returns a GitHub client which sends all requests to a local server backed by the given mux.
+func newTestGitHubClient(t *testing.T, mux *http.ServeMux) *github.Client {
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	gh := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	gh.BaseURL = baseURL
+	return gh
+}
+
+func TestFindOpenPullRequest(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "open", r.URL.Query().Get("state"))
+		if r.URL.Query().Get("head") == "owner:feature" {
+			fmt.Fprint(w, `[{"number": 12, "head": {"ref": "feature", "sha": "abc123"}}]`)
+		} else {
+			fmt.Fprint(w, `[]`)
+		}
+	})
+	gh := newTestGitHubClient(t, mux)
+
+	pr, err := findOpenPullRequest(context.Background(), gh, "owner", "repo", "feature")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, pr.GetNumber())
+	assert.Equal(t, "abc123", pr.GetHead().GetSHA())
+
+	pr, err = findOpenPullRequest(context.Background(), gh, "owner", "repo", "other")
+	assert.NoError(t, err)
+	assert.Nil(t, pr)
+}
+
+// Registers handlers which serve the given job logs for job 2 of run 1 of owner/repo.
+func handleJobLogs(mux *http.ServeMux, logs string) {
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 1, "jobs": [{"id": 2, "name": "test"}]}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/jobs/2/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+r.Host+"/raw-logs/2", http.StatusFound)
+	})
+	mux.HandleFunc("/raw-logs/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, logs)
+	})
+}
+
+func TestGetLogsWithRunID(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "run_number": 7}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("runs should not be listed when a run ID is given")
+	})
+	handleJobLogs(mux, "TestFoo 1\n")
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+
+	body, source, err := client.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", RunID: 1, Job: "test"})
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestFoo 1\n", string(logs))
+	assert.Equal(t, 7, source.Run.GetRunNumber())
+	assert.Equal(t, int64(2), source.Job.GetID())
+}
+
+func TestClientFetch(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "run_number": 7}`)
+	})
+	handleJobLogs(mux, "TestFoo 1\n")
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+
+	body, source, err := client.Fetch(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", RunID: 1, Job: "test"})
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestFoo 1\n", string(logs))
+	assert.Equal(t, int64(2), source.Job.GetID())
+}
+
+func TestGetLogsFromCache(t *testing.T) {
+	t.Parallel()
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "run_number": 7}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 1, "jobs": [{"id": 2, "name": "test", "status": "completed"}]}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/jobs/2/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+r.Host+"/raw-logs/2", http.StatusFound)
+	})
+	mux.HandleFunc("/raw-logs/2", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		fmt.Fprint(w, "TestFoo 1\n")
+	})
+	verbose := &bytes.Buffer{}
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}, Cache: &LogCache{dir: t.TempDir()}, Logger: log.New(verbose, "", 0)}
+
+	for i := 0; i < 2; i++ {
+		body, source, err := client.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", RunID: 1, Job: "test"})
+		assert.NoError(t, err)
+		logs, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		assert.NoError(t, body.Close())
+		assert.Equal(t, "TestFoo 1\n", string(logs))
+		assert.Equal(t, i > 0, source.Cached)
+	}
+	assert.Equal(t, 1, downloads)
+	assert.Contains(t, verbose.String(), "listed 1 jobs in run 1\n")
+	assert.Contains(t, verbose.String(), "cache miss for job 2\n")
+	assert.Contains(t, verbose.String(), "cache hit for job 2")
+	assert.Contains(t, verbose.String(), "downloading the logs of job 2 from 127.0.0.1:")
+}
+
+func TestGetLogsResolvesRunAndJobFromCache(t *testing.T) {
+	t.Parallel()
+	runLookups := 0
+	jobLookups := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+		runLookups++
+		fmt.Fprint(w, `{"total_count": 1, "workflow_runs": [{"id": 1, "run_number": 7, "status": "completed"}]}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		runLookups++
+		fmt.Fprint(w, `{"id": 1, "run_number": 7, "status": "completed"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		jobLookups++
+		fmt.Fprint(w, `{"total_count": 1, "jobs": [{"id": 2, "name": "test", "status": "completed"}]}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/jobs/2/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+r.Host+"/raw-logs/2", http.StatusFound)
+	})
+	mux.HandleFunc("/raw-logs/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "TestFoo 1\n")
+	})
+	gh := newTestGitHubClient(t, mux)
+	verbose := &bytes.Buffer{}
+	client := &Client{GitHub: gh, Retry: RetryPolicy{Attempts: 1}, Cache: &LogCache{dir: t.TempDir()}, Logger: log.New(verbose, "", 0)}
+
+	for i := 0; i < 2; i++ {
+		body, source, err := client.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Status: "completed", Job: "test"})
+		assert.NoError(t, err)
+		assert.NoError(t, body.Close())
+		assert.Equal(t, 7, source.Run.GetRunNumber())
+		assert.Equal(t, int64(2), source.Job.GetID())
+	}
+	assert.Equal(t, 1, runLookups)
+	assert.Equal(t, 1, jobLookups)
+	assert.Contains(t, verbose.String(), "cache hit for the latest run of test.yml on main\n")
+	assert.Contains(t, verbose.String(), "cache hit for job 'test' in run 1\n")
+
+	// an explicit run ID is always looked up
+	body, _, err := client.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", RunID: 1, Status: "completed", Job: "test"})
+	assert.NoError(t, err)
+	assert.NoError(t, body.Close())
+	assert.Equal(t, 2, runLookups)
+
+	// without a cache, the run and job are looked up every time
+	uncachedClient := &Client{GitHub: gh, Retry: RetryPolicy{Attempts: 1}}
+	body, _, err = uncachedClient.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Status: "completed", Job: "test"})
+	assert.NoError(t, err)
+	assert.NoError(t, body.Close())
+	assert.Equal(t, 3, runLookups)
+	assert.Equal(t, 2, jobLookups)
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "run_number": 7, "status": "in_progress"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 1, "jobs": [{"id": 2, "name": "test", "status": "in_progress"}]}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/jobs/2", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls < 4 {
+			fmt.Fprint(w, `{"id": 2, "name": "test", "status": "in_progress"}`)
+		} else {
+			fmt.Fprint(w, `{"id": 2, "name": "test", "status": "completed"}`)
+		}
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/jobs/2/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+r.Host+"/raw-logs/2", http.StatusFound)
+	})
+	mux.HandleFunc("/raw-logs/2", func(w http.ResponseWriter, r *http.Request) {
+		// the logs are not available until the second poll, and the final line is logged in two parts
+		switch polls {
+		case 1:
+			w.WriteHeader(http.StatusNotFound)
+		case 2:
+			fmt.Fprint(w, "TestFoo 1\nTestFoo 2")
+		case 3:
+			fmt.Fprint(w, "TestFoo 1\nTestFoo 2\n")
+		default:
+			fmt.Fprint(w, "TestFoo 1\nTestFoo 2\n--- PASS: TestFoo (1.00s)\n")
+		}
+	})
+	verbose := &bytes.Buffer{}
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}, Logger: log.New(verbose, "", 0)}
+
+	body, source, err := client.Watch(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", RunID: 1, Job: "test"}, time.Millisecond)
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestFoo 1\nTestFoo 2\n--- PASS: TestFoo (1.00s)\n", string(logs))
+	assert.Equal(t, 4, polls)
+	assert.Equal(t, int64(2), source.Job.GetID())
+	assert.Contains(t, verbose.String(), "the logs of job 2 are not available yet")
+}
+
+func TestWaitForRun(t *testing.T) {
+	t.Parallel()
+	lists := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+		lists++
+		switch lists {
+		case 1:
+			fmt.Fprint(w, `{"total_count": 0, "workflow_runs": []}`)
+		case 2:
+			fmt.Fprint(w, `{"total_count": 1, "workflow_runs": [{"id": 1, "run_number": 7, "created_at": "2023-05-02T19:30:00Z"}]}`)
+		default:
+			fmt.Fprint(w, `{"total_count": 2, "workflow_runs": [{"id": 2, "run_number": 8, "created_at": "2023-05-02T19:32:00Z"}, {"id": 1, "run_number": 7, "created_at": "2023-05-02T19:30:00Z"}]}`)
+		}
+	})
+	verbose := &bytes.Buffer{}
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Logger: log.New(verbose, "", 0)}
+	opts := FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main"}
+	after := time.Date(2023, 5, 2, 19, 31, 0, 0, time.UTC)
+
+	run, err := client.WaitForRun(context.Background(), opts, after, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), run.GetID())
+	assert.Equal(t, 3, lists)
+	assert.Contains(t, verbose.String(), "waiting for a run created after 2023-05-02T19:31:00Z: no workflow runs found for branch main and workflow test.yml\n")
+	assert.Contains(t, verbose.String(), "waiting for a run created after 2023-05-02T19:31:00Z: the latest run #7 (id 1) was created at 2023-05-02T19:30:00Z\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = client.WaitForRun(ctx, opts, time.Date(2023, 5, 2, 19, 33, 0, 0, time.UTC), time.Millisecond)
+	assert.EqualError(t, err, "timed out waiting for a run created after 2023-05-02T19:33:00Z: the latest run #8 (id 2) was created at 2023-05-02T19:32:00Z")
+}
+
+func TestGetLogsWithRunIDFromOtherRepo(t *testing.T) {
+	t.Parallel()
+	client := &Client{GitHub: newTestGitHubClient(t, http.NewServeMux()), Retry: RetryPolicy{Attempts: 1}}
+	_, _, err := client.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", RunID: 1, Job: "test"})
+	assert.EqualError(t, err, "run 1 does not belong to owner/repo")
+	assert.ErrorIs(t, err, ErrNoRuns)
+}
+
+func TestFindRunBySHA(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "", r.URL.Query().Get("branch"))
+		if r.URL.Query().Get("head_sha") == "abc123" {
+			fmt.Fprint(w, `{"total_count": 1, "workflow_runs": [{"id": 2, "head_sha": "abc123"}]}`)
+		} else {
+			fmt.Fprint(w, `{"total_count": 1, "workflow_runs": [{"id": 1, "head_sha": "def456"}]}`)
+		}
+	})
+	gh := newTestGitHubClient(t, mux)
+
+	run, err := findRun(context.Background(), gh, FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", HeadSHA: "abc123"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), run.GetID())
+}
+
+func TestFindRunWithStatusAndConclusion(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", `<http://`+r.Host+`/repos/owner/repo/actions/workflows/test.yml/runs?page=2>; rel="next"`)
+			fmt.Fprint(w, `{"total_count": 3, "workflow_runs": [{"id": 3, "status": "in_progress"}, {"id": 2, "status": "queued"}]}`)
+		default:
+			fmt.Fprint(w, `{"total_count": 3, "workflow_runs": [{"id": 1, "status": "completed", "conclusion": "failure"}]}`)
+		}
+	})
+	gh := newTestGitHubClient(t, mux)
+
+	run, err := findRun(context.Background(), gh, FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), run.GetID())
+
+	run, err = findRun(context.Background(), gh, FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Status: "completed"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), run.GetID())
+
+	run, err = findRun(context.Background(), gh, FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Conclusion: "failure"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), run.GetID())
+
+	// the workflow can be given by its path in the repository
+	run, err = findRun(context.Background(), gh, FetchOptions{Owner: "owner", Repo: "repo", Workflow: ".github/workflows/test.yml", Branch: "main"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), run.GetID())
+
+	_, err = findRun(context.Background(), gh, FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Status: "completed", Conclusion: "success"})
+	assert.EqualError(t, err, "no completed workflow runs with conclusion success found for branch main and workflow test.yml")
+
+	_, err = findRun(context.Background(), gh, FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Status: "waiting"})
+	assert.EqualError(t, err, "no waiting workflow runs found for branch main and workflow test.yml")
+}
+
+func TestFetchWithTest(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 3, "workflow_runs": [{"id": 3, "run_number": 3}, {"id": 2, "run_number": 2}, {"id": 1, "run_number": 1}]}`)
+	})
+	for runID, logs := range map[int]string{3: "TestB 1\n", 2: "2023/05/02 19:31:15 TestA 1\n", 1: "TestA 2\n"} {
+		runID, logs := runID, logs
+		mux.HandleFunc(fmt.Sprintf("/repos/owner/repo/actions/runs/%d/jobs", runID), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"total_count": 1, "jobs": [{"id": %d, "name": "test"}]}`, runID*10)
+		})
+		mux.HandleFunc(fmt.Sprintf("/repos/owner/repo/actions/jobs/%d/logs", runID*10), func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://"+r.Host+"/raw-logs"+r.URL.Path, http.StatusFound)
+		})
+		mux.HandleFunc(fmt.Sprintf("/raw-logs/repos/owner/repo/actions/jobs/%d/logs", runID*10), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, logs)
+		})
+	}
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+	opts := FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Job: "test"}
+	matchesTest := TestNamesMatcher([][]byte{[]byte("TestA")})
+
+	body, source, err := client.FetchWithTest(context.Background(), opts, 3, matchesTest, "2006/01/02 15:04:05")
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "2023/05/02 19:31:15 TestA 1\n", string(logs))
+	assert.Equal(t, int64(2), source.Run.GetID())
+	assert.Equal(t, 1, source.RunsSkipped)
+
+	// with the default layout, the timestamp hides the test name of run 2
+	body, source, err = client.FetchWithTest(context.Background(), opts, 3, matchesTest, "")
+	assert.NoError(t, err)
+	defer body.Close()
+	assert.Equal(t, int64(1), source.Run.GetID())
+
+	_, _, err = client.FetchWithTest(context.Background(), opts, 1, matchesTest, "")
+	assert.EqualError(t, err, "none of the latest 1 runs logged the selected tests")
+}
+
+func TestSearchOrg(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/org/repos", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "pushed", r.URL.Query().Get("sort"))
+		fmt.Fprint(w, `[{"name": "old", "full_name": "org/old", "archived": true}, {"name": "docs", "full_name": "org/docs"}, {"name": "other", "full_name": "org/other", "default_branch": "main"}, {"name": "infra", "full_name": "org/infra", "default_branch": "trunk"}]`)
+	})
+	mux.HandleFunc("/repos/org/docs/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	})
+	for i, repo := range []string{"other", "infra"} {
+		i, repo := i+1, repo
+		mux.HandleFunc("/repos/org/"+repo+"/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+			if repo == "infra" {
+				assert.Equal(t, "trunk", r.URL.Query().Get("branch"))
+			}
+			fmt.Fprintf(w, `{"total_count": 1, "workflow_runs": [{"id": %d, "run_number": 1}]}`, i)
+		})
+		mux.HandleFunc(fmt.Sprintf("/repos/org/%s/actions/runs/%d/jobs", repo, i), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"total_count": 1, "jobs": [{"id": %d, "name": "test"}]}`, i*10)
+		})
+		mux.HandleFunc(fmt.Sprintf("/repos/org/%s/actions/jobs/%d/logs", repo, i*10), func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://"+r.Host+"/raw-logs"+r.URL.Path, http.StatusFound)
+		})
+		mux.HandleFunc(fmt.Sprintf("/raw-logs/repos/org/%s/actions/jobs/%d/logs", repo, i*10), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "Test%s 1\n", repo)
+		})
+	}
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+	opts := FetchOptions{Owner: "org", Workflow: "test.yml", Job: "test"}
+	matchesTest := TestNamesMatcher([][]byte{[]byte("Testinfra")})
+
+	body, source, err := client.SearchOrg(context.Background(), opts, 10, 1, matchesTest, "")
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "Testinfra 1\n", string(logs))
+	assert.Equal(t, "infra", source.Repo)
+	assert.Equal(t, int64(2), source.Run.GetID())
+
+	_, _, err = client.SearchOrg(context.Background(), opts, 2, 1, matchesTest, "")
+	assert.EqualError(t, err, "none of the latest 2 repositories of org has a run of workflow test.yml which logged the selected tests")
+	assert.ErrorIs(t, err, ErrNoRuns)
+}
+
+func TestGetLogsWithoutRuns(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 0, "workflow_runs": []}`)
+	})
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+
+	_, _, err := client.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Job: "test"})
+	assert.EqualError(t, err, "no workflow runs found for branch main and workflow test.yml")
+	assert.ErrorIs(t, err, ErrNoRuns)
+
+	_, _, err = client.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", HeadSHA: "abc123", Job: "test"})
+	assert.EqualError(t, err, "no workflow runs found for commit abc123 and workflow test.yml")
+}
+
+func TestGetLogsExpired(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "run_number": 7}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 1, "jobs": [{"id": 2, "name": "test"}]}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/jobs/2/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Gone"}`, http.StatusGone)
+	})
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+
+	_, _, err := client.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", RunID: 1, Job: "test"})
+	assert.ErrorContains(t, err, "logs for run #7 have expired (older than the retention period)")
+	assert.ErrorIs(t, err, ErrLogsExpired)
+}
+
+func TestGetAllJobLogs(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "run_number": 7}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 2, "jobs": [{"id": 2, "name": "test (1)"}, {"id": 3, "name": "test (2)"}]}`)
+	})
+	for jobID, logs := range map[int]string{2: "TestFoo 1", 3: "TestFoo 2\n"} {
+		logs := logs
+		mux.HandleFunc(fmt.Sprintf("/repos/owner/repo/actions/jobs/%d/logs", jobID), func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://"+r.Host+"/raw-logs"+r.URL.Path, http.StatusFound)
+		})
+		mux.HandleFunc(fmt.Sprintf("/raw-logs/repos/owner/repo/actions/jobs/%d/logs", jobID), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, logs)
+		})
+	}
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+
+	body, source, err := client.getAllJobLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", RunID: 1})
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "===== job: test (1) =====\nTestFoo 1\n===== job: test (2) =====\nTestFoo 2\n", string(logs))
+	assert.Equal(t, 7, source.Run.GetRunNumber())
+
+	body, _, err = client.getAllJobLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", RunID: 1, Job: "* (2)"})
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err = io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "===== job: test (2) =====\nTestFoo 2\n", string(logs))
+
+	_, _, err = client.getAllJobLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", RunID: 1, Job: "lint*"})
+	assert.EqualError(t, err, "did not find matching job")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestGetWholeRunLogs(t *testing.T) {
+	t.Parallel()
+	archive := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(archive)
+	for name, content := range map[string]string{
+		"1_test (2).txt":        "TestFoo 2\n",
+		"0_test (1).txt":        "TestFoo 1",
+		"test (1)/1_Run go.txt": "TestFoo 1",
+	} {
+		file, err := zipWriter.Create(name)
+		assert.NoError(t, err)
+		_, err = file.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zipWriter.Close())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "run_number": 7}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("jobs should not be listed when the whole run is downloaded")
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+r.Host+"/raw-logs/1", http.StatusFound)
+	})
+	mux.HandleFunc("/raw-logs/1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive.Bytes())
+	})
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+
+	body, source, err := client.Fetch(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", RunID: 1, WholeRun: true})
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "===== job: test (1) =====\nTestFoo 1\n===== job: test (2) =====\nTestFoo 2\n", string(logs))
+	assert.Equal(t, 7, source.Run.GetRunNumber())
+
+	_, err = readRunArchive([]byte("not a zip"))
+	assert.ErrorContains(t, err, "failed to read the log archive")
+}
+
+func TestFindJobOnLaterPage(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", `<http://`+r.Host+`/repos/owner/repo/actions/runs/1/jobs?page=2>; rel="next"`)
+			fmt.Fprint(w, `{"total_count": 3, "jobs": [{"id": 1, "name": "test (us-east-1)"}]}`)
+		case "2":
+			w.Header().Set("Link", `<http://`+r.Host+`/repos/owner/repo/actions/runs/1/jobs?page=3>; rel="next"`)
+			fmt.Fprint(w, `{"total_count": 3, "jobs": [{"id": 2, "name": "test (us-west-2)"}]}`)
+		default:
+			fmt.Fprint(w, `{"total_count": 3, "jobs": [{"id": 3, "name": "test (eu-west-1)"}]}`)
+		}
+	})
+	gh := newTestGitHubClient(t, mux)
+
+	job, err := findJob(context.Background(), gh, "owner", "repo", 1, "test (us-west-2)")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), job.GetID())
+
+	job, err = findJob(context.Background(), gh, "owner", "repo", 1, "test (eu-west-1)")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), job.GetID())
+
+	_, err = findJob(context.Background(), gh, "owner", "repo", 1, "lint")
+	assert.EqualError(t, err, "did not find matching job")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	job, err = findJob(context.Background(), gh, "owner", "repo", 1, "test (us-w*)")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), job.GetID())
+
+	_, err = findJob(context.Background(), gh, "owner", "repo", 1, "test (*)")
+	assert.EqualError(t, err, "job test (*) matches 3 jobs, specify one of them or read them all via --all-jobs: test (us-east-1), test (us-west-2), test (eu-west-1)")
+
+	_, err = findJob(context.Background(), gh, "owner", "repo", 1, "test [")
+	assert.ErrorContains(t, err, "invalid job pattern test [")
+}
+
+func TestListJobs(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", `<http://`+r.Host+`/repos/owner/repo/actions/runs/1/jobs?page=2>; rel="next"`)
+			fmt.Fprint(w, `{"total_count": 2, "jobs": [{"id": 1, "name": "lint", "conclusion": "success"}]}`)
+		} else {
+			fmt.Fprint(w, `{"total_count": 2, "jobs": [{"id": 2, "name": "test", "status": "in_progress"}]}`)
+		}
+	})
+	gh := newTestGitHubClient(t, mux)
+
+	jobs, err := listJobs(context.Background(), gh, "owner", "repo", 1)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "lint", jobs[0].GetName())
+	assert.Equal(t, "test", jobs[1].GetName())
+}
+
+func TestDownloadLogsRetriesServerErrors(t *testing.T) {
+	t.Parallel()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "TestFoo 1\n")
+	}))
+	t.Cleanup(server.Close)
+
+	body, err := downloadLogs(context.Background(), server.URL, RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond}, nil, nil)
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestFoo 1\n", string(logs))
+	assert.Equal(t, 3, requests)
+}
+
+func TestDownloadLogsReportsProgress(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "20")
+		fmt.Fprint(w, "TestFoo 1\nTestFoo 2\n")
+	}))
+	t.Cleanup(server.Close)
+
+	var downloaded, total int64
+	body, err := downloadLogs(context.Background(), server.URL, RetryPolicy{Attempts: 1}, nil, func(d int64, t int64) {
+		downloaded, total = d, t
+	})
+	assert.NoError(t, err)
+	defer body.Close()
+	_, err = io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), downloaded)
+	assert.Equal(t, int64(20), total)
+}
+
+func TestDownloadLogsWithHTTPClient(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "TestFoo 1\n")
+	}))
+	t.Cleanup(server.Close)
+
+	transport := &recordingTransport{}
+	body, err := downloadLogs(context.Background(), server.URL, RetryPolicy{Attempts: 1}, &http.Client{Transport: transport}, nil)
+	assert.NoError(t, err)
+	defer body.Close()
+	logs, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestFoo 1\n", string(logs))
+	assert.Len(t, transport.requests, 1)
+}
+
+func TestDownloadLogsDoesNotRetryClientErrors(t *testing.T) {
+	t.Parallel()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := downloadLogs(context.Background(), server.URL, RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond}, nil, nil)
+	assert.EqualError(t, err, "failed to download logs after 1 attempt(s): unexpected status code: 403 Forbidden")
+	assert.ErrorIs(t, err, ErrDownload)
+	assert.Equal(t, 1, requests)
+}
+
+func TestGetLogsTimeout(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := client.getLogs(ctx, FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", RunID: 1, Job: "test"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "timed out finding the workflow run")
+}
+
+func TestGetLogsRateLimited(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/test.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Authorization")) > 0 {
+			w.Header().Set("X-RateLimit-Limit", "5000")
+		} else {
+			w.Header().Set("X-RateLimit-Limit", "60")
+		}
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "1683055875")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "API rate limit exceeded"}`)
+	})
+	client := &Client{GitHub: newTestGitHubClient(t, mux), Retry: RetryPolicy{Attempts: 1}}
+	reset := time.Unix(1683055875, 0).Local().Format(time.RFC1123)
+
+	_, _, err := client.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Job: "test"})
+	var rateLimitErr *github.RateLimitError
+	assert.ErrorAs(t, err, &rateLimitErr)
+	assert.ErrorContains(t, err, "GitHub API rate limit exceeded, it resets at "+reset+". Set GITHUB_TOKEN")
+
+	// a token would not help if the requests already have one
+	authenticatedClient := &Client{GitHub: github.NewTokenClient(context.Background(), "token"), Retry: RetryPolicy{Attempts: 1}}
+	authenticatedClient.GitHub.BaseURL = client.GitHub.BaseURL
+	_, _, err = authenticatedClient.getLogs(context.Background(), FetchOptions{Owner: "owner", Repo: "repo", Workflow: "test.yml", Branch: "main", Job: "test"})
+	assert.ErrorAs(t, err, &rateLimitErr)
+	assert.ErrorContains(t, err, "GitHub API rate limit exceeded, it resets at "+reset+": ")
+	assert.NotContains(t, err.Error(), "GITHUB_TOKEN")
+}
@@ -0,0 +1,1227 @@
+// Package logviewer retrieves Terratest logs from GitHub Actions and filters out the logs of individual tests
+// from interleaved parallel test output. The filters are Transforms which stream the logs through RunPipeline.
+package logviewer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Matches an ANSI select graphic rendition sequence, e.g. "\x1b[1;31m".
+var ansiSGRRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// Returns a transform which removes ANSI select graphic rendition sequences, which set colors and text styles, from the logs.
+func StripANSITransform() Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			_, err := w.Write(ansiSGRRegex.ReplaceAll(line, nil))
+			return err
+		})
+	}
+}
+
+// The text which replaces each secret removed by RedactTransform.
+const RedactedText = "***REDACTED***"
+
+// Matches 40 characters like an AWS secret access key. The match is only a secret if it is not part of a longer run of such characters,
+// which redact checks as RE2 has no lookaround, so that the characters around a secret are not consumed and an adjacent secret still matches.
+var secretAccessKeyRegex = regexp.MustCompile(`[A-Za-z0-9/+]{40}`)
+
+// Match values which look like secrets: AWS access key IDs, 40 character strings like AWS secret access keys, and bearer tokens.
+// If a pattern has a submatch, only the first submatch is a secret, e.g. the token after "Bearer ".
+var RedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	secretAccessKeyRegex,
+	regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]+=*)`),
+}
+
+// Returns whether the given byte can be part of an AWS secret access key.
+func isSecretAccessKeyByte(b byte) bool {
+	return 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || b == '/' || b == '+'
+}
+
+// Returns a transform which replaces each match of the given patterns with RedactedText, e.g. with RedactPatterns.
+// If a pattern has a submatch, only its first submatch is replaced.
+func RedactTransform(patterns []*regexp.Regexp) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			line, rawLine := cutRawLine(line)
+			for _, pattern := range patterns {
+				line = redact(line, pattern)
+			}
+			_, err := w.Write(withRawLine(line, rawLine))
+			return err
+		})
+	}
+}
+
+// Returns the given line with each match of the given pattern, or its first submatch, replaced with RedactedText.
+func redact(line []byte, pattern *regexp.Regexp) []byte {
+	matches := pattern.FindAllSubmatchIndex(line, -1)
+	if matches == nil {
+		return line
+	}
+
+	redacted := make([]byte, 0, len(line))
+	end := 0
+	for _, match := range matches {
+		start, stop := match[0], match[1]
+		if len(match) >= 4 && match[2] >= 0 {
+			start, stop = match[2], match[3]
+		}
+		if start == stop {
+			continue
+		}
+		if pattern == secretAccessKeyRegex && (start > 0 && isSecretAccessKeyByte(line[start-1]) || stop < len(line) && isSecretAccessKeyByte(line[stop])) {
+			continue
+		}
+		redacted = append(redacted, line[end:start]...)
+		redacted = append(redacted, RedactedText...)
+		end = stop
+	}
+	return append(redacted, line[end:]...)
+}
+
+// Returns a transform which removes lines whose message is empty or only whitespace.
+// If keepOne is set, each run of such lines is collapsed into its first line instead, like cat --squeeze-blank.
+// Kept timestamps must parse using the given layout, or RFC 3339 if it is empty.
+func CompactLinesTransform(keepOne bool, layout string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		previousBlank := false
+		return forEachLine(r, func(line []byte) error {
+			blank := len(bytes.TrimSpace(line[startOfMessage(line, layout):])) == 0
+			skip := blank && (!keepOne || previousBlank)
+			previousBlank = blank
+			if skip {
+				return nil
+			}
+			_, err := w.Write(line)
+			return err
+		})
+	}
+}
+
+// Returns a transform which collapses runs of consecutive identical lines into the first line of the run followed by the run length, e.g. "Still creating... (x3)".
+// Kept timestamps must parse using the given layout, or RFC 3339 if it is empty.
+func DedupLinesTransform(layout string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		// the first line of the run is output, and the last line of the run has the run's trailing newline if there is one
+		first := []byte{}
+		last := []byte{}
+		repeats := 0
+		message := func(line []byte) []byte {
+			// kept timestamps differ between repeats, so only the messages are compared
+			return bytes.TrimSuffix(line[startOfMessage(line, layout):], []byte("\n"))
+		}
+		writeRun := func() error {
+			if repeats == 0 {
+				return nil
+			}
+			if repeats == 1 {
+				_, err := w.Write(first)
+				return err
+			}
+			content := bytes.TrimSuffix(first, []byte("\n"))
+			_, err := fmt.Fprintf(w, "%s (x%d)%s", content, repeats, last[len(bytes.TrimSuffix(last, []byte("\n"))):])
+			return err
+		}
+
+		err := forEachLine(r, func(line []byte) error {
+			// the last line may be missing its newline but is still a repeat
+			if repeats > 0 && bytes.Equal(message(line), message(last)) {
+				repeats++
+				last = line
+				return nil
+			}
+			if err := writeRun(); err != nil {
+				return err
+			}
+			first = line
+			last = line
+			repeats = 1
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return writeRun()
+	}
+}
+
+// Returns a transform which keeps only the first maxLines lines of the logs, followed by a marker saying how many lines were omitted.
+func TruncateLinesTransform(maxLines int) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		lineCount := 0
+		err := forEachLine(r, func(line []byte) error {
+			lineCount++
+			if lineCount > maxLines {
+				return nil
+			}
+			_, err := w.Write(line)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if lineCount > maxLines {
+			_, err = fmt.Fprintf(w, "... (%d more lines omitted, use -output to save full logs)\n", lineCount-maxLines)
+		}
+		return err
+	}
+}
+
+// Returns a transform which keeps only the first n lines of the logs, then stops reading.
+// If readAll is set, the rest of the logs are read and discarded instead, so that the transforms before it see every line,
+// e.g. to detect a failure which is logged after the first n lines.
+func HeadLinesTransform(n int, readAll bool) Transform {
+	errHeadDone := errors.New("head done")
+	return func(r io.Reader, w io.Writer) error {
+		lineCount := 0
+		err := forEachLine(r, func(line []byte) error {
+			if lineCount == n {
+				if readAll {
+					return nil
+				}
+				return errHeadDone
+			}
+			lineCount++
+			_, err := w.Write(line)
+			return err
+		})
+		if err == errHeadDone {
+			return nil
+		}
+		return err
+	}
+}
+
+// Returns a transform which soft-wraps lines longer than width characters onto several lines,
+// breaking at the last space which fits where there is one and mid-word otherwise.
+// Like every width in this package, the width counts runes rather than bytes, so a multibyte UTF-8 character is never split.
+func WrapLinesTransform(width int) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			text, newline := bytes.CutSuffix(line, []byte("\n"))
+			for utf8.RuneCount(text) > width {
+				breakIdx := runeOffset(text, width)
+				// a space just past the width can be dropped as the break itself
+				spaceIdx := bytes.LastIndexByte(text[:runeOffset(text, width+1)], ' ')
+				if spaceIdx > 0 {
+					breakIdx = spaceIdx
+				}
+				if _, err := fmt.Fprintf(w, "%s\n", text[:breakIdx]); err != nil {
+					return err
+				}
+				text = text[breakIdx:]
+				if spaceIdx > 0 {
+					text = text[1:]
+				}
+			}
+			if _, err := w.Write(text); err != nil {
+				return err
+			}
+			if newline {
+				_, err := w.Write([]byte("\n"))
+				return err
+			}
+			return nil
+		})
+	}
+}
+
+// Returns a transform which cuts lines longer than width characters to width characters, ending with an ellipsis.
+func TruncateLongLinesTransform(width int) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			text, newline := bytes.CutSuffix(line, []byte("\n"))
+			if utf8.RuneCount(text) > width {
+				truncated := append(append([]byte{}, text[:runeOffset(text, width-1)]...), "…"...)
+				if newline {
+					truncated = append(truncated, '\n')
+				}
+				line = truncated
+			}
+			_, err := w.Write(line)
+			return err
+		})
+	}
+}
+
+// Returns the byte offset of the rune at the given index of str, or the length of str if it has fewer runes.
+func runeOffset(str []byte, runeIdx int) int {
+	offset := 0
+	for i := 0; i < runeIdx && offset < len(str); i++ {
+		_, size := utf8.DecodeRune(str[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// Returns a transform which keeps only the last n lines of the logs.
+func TailLinesTransform(n int) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		// the last n lines, in the order they were read starting from start
+		lines := make([][]byte, 0, n)
+		start := 0
+		err := forEachLine(r, func(line []byte) error {
+			if len(lines) < n {
+				lines = append(lines, line)
+			} else {
+				lines[start] = line
+				start = (start + 1) % n
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range lines {
+			if _, err := w.Write(lines[(start+i)%len(lines)]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Returns new logs with only the lines of the given logs which summarize a test result, as they were logged.
+func ParseSummary(logs []byte) []byte {
+	_, lines := parseSummary(logs)
+	return bytes.Join(lines, nil)
+}
+
+// The result of a test or subtest, as summarized by go test.
+type TestResult struct {
+	// Name is the full name of the test, e.g. TestAll/foo for a subtest.
+	Name string
+	// Status is PASS, FAIL, or SKIP. A skipped test did not run to completion, e.g. because it called t.Skip.
+	Status string
+	// Duration is how long the test took, or -1 if its result does not say.
+	Duration time.Duration
+	// Depth is the number of tests which the test is nested in, e.g. 1 for TestAll/foo.
+	Depth int
+}
+
+// Returns the result in the format of go test, e.g. "    --- FAIL: TestAll/foo (10.11s)".
+func (r TestResult) String() string {
+	line := fmt.Sprintf("%s--- %s: %s", strings.Repeat("    ", r.Depth), r.Status, r.Name)
+	if r.Duration >= 0 {
+		line += fmt.Sprintf(" (%.2fs)", r.Duration.Seconds())
+	}
+	return line
+}
+
+// Returns the test results in the given logs in the order they were logged.
+func ParseSummaryStructured(logs []byte) []TestResult {
+	results, _ := parseSummary(logs)
+	return results
+}
+
+// Returns the test results in the given logs in the order they were logged, along with the lines which contain a result
+// like ParseSummaryTransform, which includes results that do not name a test.
+func parseSummary(logs []byte) ([]TestResult, [][]byte) {
+	results := []TestResult{}
+	lines := [][]byte{}
+	forEachLine(bytes.NewReader(logs), func(line []byte) error {
+		if matchingContains(line, testResultPrefixes) {
+			lines = append(lines, append([]byte{}, line...))
+		}
+		match := testResultRegex.FindSubmatch(line[startOfMessage(line, ""):])
+		if match == nil {
+			return nil
+		}
+		result := TestResult{Name: string(match[2]), Status: string(match[1]), Duration: -1, Depth: bytes.Count(match[2], []byte("/"))}
+		if seconds, err := strconv.ParseFloat(string(match[3]), 64); err == nil {
+			result.Duration = time.Duration(math.Round(seconds * float64(time.Second)))
+		}
+		results = append(results, result)
+		return nil
+	})
+	return results, lines
+}
+
+var (
+	testPassResult     = []byte("--- PASS")
+	testFailResult     = []byte("--- FAIL")
+	testSkipResult     = []byte("--- SKIP")
+	testResultPrefixes = [][]byte{testPassResult, testFailResult, testSkipResult}
+)
+
+// Returns a transform which keeps only the lines of the logs which summarize a test result.
+// If matchesTest is not nil, only the results of selected tests (and their subtests) are kept.
+func ParseSummaryTransform(matchesTest TestMatcher) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			for _, prefix := range testResultPrefixes {
+				resultIdx := bytes.Index(line, prefix)
+				if resultIdx < 0 {
+					continue
+				}
+				// the test name follows the result, e.g. "--- PASS: TestA (1.00s)"
+				testNameIdx := resultIdx + len(prefix) + len(": ")
+				if matchesTest != nil && (testNameIdx > len(line) || matchesTest(line, testNameIdx) == nil) {
+					return nil
+				}
+				_, err := w.Write(line)
+				return err
+			}
+			return nil
+		})
+	}
+}
+
+// Returns a transform which outputs the sorted names of the tests which passed only after failing, e.g. in a retry loop or a rerun,
+// along with how many times each failed. A test fails each time the logs contain its failure marker (=== NAME) or a failed result.
+// If matchesTest is not nil, only the selected tests (and their subtests) are reported.
+func FlakinessReportTransform(matchesTest TestMatcher) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		failures := map[string]int{}
+		passed := map[string]bool{}
+		err := forEachLine(r, func(line []byte) error {
+			offset := startOfMessage(line, "")
+			if result := testResultRegex.FindSubmatch(line[offset:]); result != nil {
+				testName := string(result[2])
+				// the last result of a test is its final result
+				passed[testName] = bytes.Equal(result[1], []byte("PASS"))
+				if bytes.Equal(result[1], []byte("FAIL")) {
+					failures[testName]++
+				}
+			} else if hasPrefix(line, offset, testFailurePrefix) {
+				failures[string(leadingToken(line, offset+len(testFailurePrefix)))]++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		testNames := []string{}
+		for testName, count := range failures {
+			if count > 0 && passed[testName] && (matchesTest == nil || matchesTest([]byte(testName), 0) != nil) {
+				testNames = append(testNames, testName)
+			}
+		}
+		sort.Strings(testNames)
+		for _, testName := range testNames {
+			if _, err := fmt.Fprintf(w, "%s\tpassed after %d failures\n", testName, failures[testName]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Returns a transform which outputs only counts describing the logs: the total number of lines, the number of lines of selected tests
+// if matchesTest is not nil, and the number of passed, failed, and skipped results of selected tests if the logs contain any results.
+// Lines are attributed to tests like FilterLogsWithTestPrefixTransform.
+func CountTransform(matchesTest TestMatcher, testPrefix string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		selection := testSelection{matchesTest: matchesTest, testPrefix: []byte(testPrefix)}
+		lineCount := 0
+		matchingLineCount := 0
+		statusCounts := map[string]int{}
+		err := forEachLine(r, func(line []byte) error {
+			lineCount++
+			offset := startOfMessage(line, "")
+			if matchesTest != nil {
+				if _, selected := selection.next(line, offset); selected {
+					matchingLineCount++
+				}
+			}
+			if result := testResultRegex.FindSubmatch(line[offset:]); result != nil && (matchesTest == nil || matchesTest(result[2], 0) != nil) {
+				statusCounts[string(result[1])]++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		counts := fmt.Sprintf("lines\t%d\n", lineCount)
+		if matchesTest != nil {
+			counts += fmt.Sprintf("matching lines\t%d\n", matchingLineCount)
+		}
+		if len(statusCounts) > 0 {
+			counts += fmt.Sprintf("passed\t%d\nfailed\t%d\nskipped\t%d\n", statusCounts["PASS"], statusCounts["FAIL"], statusCounts["SKIP"])
+		}
+		_, err = io.WriteString(w, counts)
+		return err
+	}
+}
+
+// Returns a transform which outputs the sorted names of the top-level tests which logged lines, and how many lines each logged.
+// A line is logged by a test if it starts with the test's name, or the name of one of its subtests, and test names start with testPrefix.
+func ListTestsTransform(testPrefix string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		lineCounts := map[string]int{}
+		err := forEachLine(r, func(line []byte) error {
+			if testName := topLevelTestName(line, 0, []byte(testPrefix)); testName != nil {
+				lineCounts[string(testName)]++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		testNames := make([]string, 0, len(lineCounts))
+		for testName := range lineCounts {
+			testNames = append(testNames, testName)
+		}
+		sort.Strings(testNames)
+		for _, testName := range testNames {
+			if _, err := fmt.Fprintf(w, "%s\t%d\n", testName, lineCounts[testName]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Returns the name of the top-level test which logged the given line, starting at the given offset, or nil if it was not logged by a test.
+// The names of tests start with the given prefix.
+func topLevelTestName(line []byte, offset int, testPrefix []byte) []byte {
+	if !hasPrefix(line, offset, testPrefix) {
+		return nil
+	}
+	testName, _, _ := bytes.Cut(leadingToken(line, offset), []byte("/"))
+	return testName
+}
+
+// Returns a transform which passes the logs through unchanged, adding the names of the top-level tests which logged lines to names.
+// The names of tests start with testPrefix, and kept timestamps must parse using the given layout, or RFC 3339 if it is empty.
+func CollectTestNamesTransform(names map[string]bool, testPrefix string, layout string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			if testName := topLevelTestName(line, startOfMessage(line, layout), []byte(testPrefix)); testName != nil {
+				names[string(testName)] = true
+			}
+			_, err := w.Write(line)
+			return err
+		})
+	}
+}
+
+// Returns the available test name closest to the given test name if it is likely a typo of it, otherwise returns an empty string.
+func SuggestTestName(testName string, available map[string]bool) string {
+	// only the top-level test is compared, as subtests are not listed separately
+	testName, _, _ = strings.Cut(testName, "/")
+	if available[testName] {
+		return ""
+	}
+	suggestion := ""
+	bestDistance := 3
+	for name := range available {
+		distance := editDistance(testName, name)
+		if distance < bestDistance || (distance == bestDistance && len(suggestion) > 0 && name < suggestion) {
+			suggestion = name
+			bestDistance = distance
+		}
+	}
+	return suggestion
+}
+
+// Returns the Levenshtein distance between the given strings.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			current[j] = minInt(substitution, minInt(previous[j], current[j-1])+1)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Returns a transform which passes the logs through unchanged, setting failed if they contain a failed test result.
+func DetectFailureTransform(failed *bool) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			if bytes.Contains(line, testFailResult) {
+				*failed = true
+			}
+			_, err := w.Write(line)
+			return err
+		})
+	}
+}
+
+// Returns the timestamp at the start of the line at the given offset, along with the offset of the rest of the line.
+// The timestamp must parse using the given layout and be followed by a space or the end of the line.
+// The timestamp spans as many space-separated fields as the layout does, e.g. two for "2006-01-02 15:04:05".
+func parseTimestampPrefix(logs []byte, offset int, layout string) (time.Time, int, error) {
+	token := leadingTokens(logs, offset, len(strings.Fields(layout)))
+	timestamp, err := time.Parse(layout, string(token))
+	if err != nil {
+		return time.Time{}, offset, err
+	}
+	endOfTimestampIdx := offset + len(token)
+	if hasPrefix(logs, endOfTimestampIdx, []byte(" ")) {
+		return timestamp, endOfTimestampIdx + 1, nil
+	}
+	// a blank log line is only a timestamp
+	return timestamp, endOfTimestampIdx, nil
+}
+
+// Returns new logs.
+// Removes the timestamp prefix from each line of the logs.
+// The timestamp must parse using the given layout, or RFC 3339 if it is empty. Lines without a timestamp are left unchanged.
+func RemoveTimestampPrefix(logs []byte, layout string) []byte {
+	newLogs, _ := transformBytes(logs, RemoveTimestampPrefixTransform(layout))
+	return newLogs
+}
+
+// A point in time given by --since or --until, either absolute or relative to the start of the run.
+type TimeBound struct {
+	at       time.Time
+	offset   time.Duration
+	relative bool
+}
+
+// Returns the timeBound given by an RFC 3339 timestamp or a duration, or nil if the value is empty.
+func ParseTimeBound(value string) (*TimeBound, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	if at, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return &TimeBound{at: at}, nil
+	}
+	offset, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither an RFC 3339 timestamp nor a duration", value)
+	}
+	return &TimeBound{offset: offset, relative: true}, nil
+}
+
+// Returns the time of the bound for a run which started at the given time.
+func (b TimeBound) resolve(start time.Time) time.Time {
+	if b.relative {
+		return start.Add(b.offset)
+	}
+	return b.at
+}
+
+// Returns a transform which includes only lines whose timestamp is within the given bounds, along with lines without
+// a timestamp which follow an included line. A nil bound does not limit the range.
+// Relative bounds are resolved against start, or against the first timestamp in the logs if start is zero.
+func FilterTimeRangeTransform(layout string, since *TimeBound, until *TimeBound, start time.Time) Transform {
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+
+	return func(r io.Reader, w io.Writer) error {
+		priorLineIncluded := false
+		return forEachLine(r, func(line []byte) error {
+			content, _ := cutRawLine(line)
+			timestamp, _, err := parseTimestampPrefix(content, 0, layout)
+			if err == nil {
+				if start.IsZero() {
+					start = timestamp
+				}
+				priorLineIncluded = (since == nil || !timestamp.Before(since.resolve(start))) && (until == nil || !timestamp.After(until.resolve(start)))
+			}
+			if !priorLineIncluded {
+				return nil
+			}
+			_, err = w.Write(line)
+			return err
+		})
+	}
+}
+
+// The layout of timestamps output by --timestamps local, which keeps millisecond precision.
+const localTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Returns the offset of the message in the given log line, which is after the timestamp if the timestamp was kept.
+// Kept timestamps must parse using the given layout, or RFC 3339 if it is empty, which includes localTimestampLayout.
+func startOfMessage(line []byte, layout string) int {
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+	if _, startOfMessageIdx, err := parseTimestampPrefix(line, 0, layout); err == nil {
+		return startOfMessageIdx
+	}
+	return 0
+}
+
+// Returns a transform which reformats the timestamp prefix of each line of the logs in the local timezone using localTimestampLayout.
+// The timestamp must parse using the given layout, or RFC 3339 if it is empty. Lines without a timestamp are left unchanged.
+func LocalizeTimestampPrefixTransform(layout string) Transform {
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			timestamp, startOfLineIdx, err := parseTimestampPrefix(line, 0, layout)
+			if err == nil {
+				if _, err := io.WriteString(w, timestamp.Local().Format(localTimestampLayout)+" "); err != nil {
+					return err
+				}
+			}
+			_, err = w.Write(line[startOfLineIdx:])
+			return err
+		})
+	}
+}
+
+// Returns a transform which removes the timestamp prefix from each line of the logs.
+// The timestamp must parse using the given layout, or RFC 3339 if it is empty. Lines without a timestamp, such as
+// ##[group] markers, are left unchanged.
+func RemoveTimestampPrefixTransform(layout string) Transform {
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			_, startOfLineIdx, _ := parseTimestampPrefix(line, 0, layout)
+			_, err := w.Write(line[startOfLineIdx:])
+			return err
+		})
+	}
+}
+
+// Returns the name of a selected test which the given string starts with at the given offset, or nil if there is none.
+type TestMatcher func(str []byte, offset int) []byte
+
+// Returns a testMatcher which selects the given test names and their subtests.
+// A subtest's full name, e.g. TestFoo/subcase, is returned for its lines. Other tests which start with a given name, e.g. TestFooBar, are not selected.
+func TestNamesMatcher(testNames [][]byte) TestMatcher {
+	return func(str []byte, offset int) []byte {
+		for _, testName := range testNames {
+			if !hasPrefix(str, offset, testName) {
+				continue
+			}
+			endOfNameIdx := offset + len(testName)
+			if endOfNameIdx == len(str) || str[endOfNameIdx] == ' ' || str[endOfNameIdx] == '\n' {
+				return testName
+			}
+			if str[endOfNameIdx] == '/' {
+				return leadingToken(str, offset)
+			}
+		}
+		return nil
+	}
+}
+
+// Returns a testMatcher which selects tests whose name matches the given regular expression.
+// The test name is the token before the first space.
+func TestRegexMatcher(re *regexp.Regexp) TestMatcher {
+	return func(str []byte, offset int) []byte {
+		token := leadingToken(str, offset)
+		if len(token) > 0 && re.Match(token) {
+			return token
+		}
+		return nil
+	}
+}
+
+// Returns new logs.
+// Removes any of the given test names from the start of each log line if it is present.
+func RemoveTestNamePrefix(logs []byte, testNames [][]byte) []byte {
+	newLogs, _ := transformBytes(logs, RemoveTestNamePrefixTransform(TestNamesMatcher(testNames), ""))
+	return newLogs
+}
+
+// The indentation of each level of subtest nesting by IndentSubtestsTransform.
+var subtestIndent = []byte("    ")
+
+// Returns a transform which indents the message of each line logged by a subtest once per level of nesting, e.g. once for TestA/foo,
+// so that the logs read like a tree. The indentation follows the test name, so it is kept when the test name is removed.
+// Lines which continue the output of a subtest, such as those after its === RUN or === NAME line, are indented along with it until a test result.
+// The names of tests start with testPrefix, and kept timestamps must parse using the given layout, or RFC 3339 if it is empty.
+func IndentSubtestsTransform(testPrefix string, layout string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		depth := 0
+		return forEachLine(r, func(line []byte) error {
+			offset := startOfMessage(line, layout)
+			if testResultRegex.Match(line[offset:]) {
+				// results are already indented by go test
+				depth = 0
+				_, err := w.Write(line)
+				return err
+			}
+			if nameOffset := testMarkerNameOffset(line, offset); nameOffset >= 0 {
+				depth = bytes.Count(leadingToken(line, nameOffset), []byte("/"))
+			} else if hasPrefix(line, offset, []byte(testPrefix)) {
+				testName := leadingToken(line, offset)
+				depth = bytes.Count(testName, []byte("/"))
+				offset += len(testName)
+				if hasPrefix(line, offset, []byte(" ")) {
+					offset++
+				}
+			}
+			if depth == 0 {
+				_, err := w.Write(line)
+				return err
+			}
+			indented := make([]byte, 0, len(line)+depth*len(subtestIndent))
+			indented = append(indented, line[:offset]...)
+			indented = append(indented, bytes.Repeat(subtestIndent, depth)...)
+			indented = append(indented, line[offset:]...)
+			_, err := w.Write(indented)
+			return err
+		})
+	}
+}
+
+// Returns a transform which removes the name of any selected test from the start of each log line if it is present.
+// A name is only removed if it is followed by a space, a subtest name, or the end of the line, so that e.g. TestFoo is not removed from TestFooBar.
+// Kept timestamps must parse using the given layout, or RFC 3339 if it is empty.
+func RemoveTestNamePrefixTransform(matchesTest TestMatcher, layout string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			startOfMessageIdx := startOfMessage(line, layout)
+			if testName := matchesTest(line, startOfMessageIdx); testName != nil {
+				// the matcher only returns a whole test name, so only the space following it remains to be removed
+				endOfPrefixIdx := startOfMessageIdx + len(testName)
+				if hasPrefix(line, endOfPrefixIdx, []byte(" ")) {
+					endOfPrefixIdx++
+				}
+				line = append(line[:startOfMessageIdx:startOfMessageIdx], line[endOfPrefixIdx:]...)
+			}
+			_, err := w.Write(line)
+			return err
+		})
+	}
+}
+
+// Returns new logs.
+// Includes log lines which begin with any of the given test names.
+// Also includes lines with appear to be part of one of the given tests, but which do not start with its test name.
+func FilterLogs(logs []byte, testNames [][]byte) ([]byte, error) {
+	return transformBytes(logs, FilterLogsTransform(TestNamesMatcher(testNames)))
+}
+
+// The prefix which the names of Go tests start with, which marks the start of the logs of a new test.
+const DefaultTestPrefix = "Test"
+
+// Returns a transform which includes log lines which begin with the name of a selected test.
+// Also includes lines with appear to be part of a selected test, but which do not start with its test name.
+func FilterLogsTransform(matchesTest TestMatcher) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return filterLogs(r, w, matchesTest, []byte(DefaultTestPrefix), "", false)
+	}
+}
+
+// Returns a transform like FilterLogsTransform for tests whose names start with the given prefix instead of "Test",
+// e.g. "Spec" for a harness other than go test. Kept timestamps must parse using the given layout, or RFC 3339 if it is empty.
+func FilterLogsWithTestPrefixTransform(matchesTest TestMatcher, testPrefix string, layout string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return filterLogs(r, w, matchesTest, []byte(testPrefix), layout, false)
+	}
+}
+
+// Returns a transform like FilterLogsWithTestPrefixTransform which also includes the setup lines logged before the first test,
+// e.g. by TestMain, init, or other package-level setup, which are not part of any test. The setup ends at the first line
+// which starts with testPrefix or with a test marker such as "=== RUN   TestFoo".
+func FilterLogsWithSetupTransform(matchesTest TestMatcher, testPrefix string, layout string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return filterLogs(r, w, matchesTest, []byte(testPrefix), layout, true)
+	}
+}
+
+func filterLogs(r io.Reader, w io.Writer, matchesTest TestMatcher, testPrefix []byte, layout string, includeSetup bool) error {
+	selection := testSelection{matchesTest: matchesTest, testPrefix: testPrefix}
+	inSetup := includeSetup
+	return forEachLine(r, func(line []byte) error {
+		startOfMessageIdx := startOfMessage(line, layout)
+		if inSetup && (hasPrefix(line, startOfMessageIdx, testPrefix) || testMarkerNameOffset(line, startOfMessageIdx) >= 0) {
+			inSetup = false
+		}
+		if _, selected := selection.next(line, startOfMessageIdx); selected || inSetup {
+			_, err := w.Write(line)
+			return err
+		}
+		return nil
+	})
+}
+
+// Tracks which selected test, if any, log lines belong to as the lines are visited in order.
+// A line which starts with testPrefix starts the logs of a new test, which is "Test" if it is nil.
+type testSelection struct {
+	matchesTest TestMatcher
+	testPrefix  []byte
+	// the selected test which logged the most recent line which named a test, or nil if that test is not selected
+	currentTest []byte
+}
+
+// The marker which go test logs when a parallel test pauses until the sequential tests finish, e.g. "=== PAUSE TestFoo".
+// The output after it belongs to another test.
+var testPauseMarker = []byte("=== PAUSE ")
+
+// Returns whether the log line starting at the given offset is part of a selected test, and the name of that test.
+// A line which starts with a test name, or with a test marker such as "=== CONT  TestFoo", belongs to the named test.
+// Other lines continue the output of the test named by the most recent line which named one, so the output of parallel
+// tests is attributed to the right test as go test names the test it switches to when their output interleaves.
+func (s *testSelection) next(logs []byte, offset int) ([]byte, bool) {
+	// if the line has a selected test name as a prefix, it is selected
+	if testName := s.matchesTest(logs, offset); testName != nil {
+		s.currentTest = testName
+		return testName, true
+	}
+	// a marker such as "=== RUN   TestFoo" or "--- FAIL: TestFoo" is part of the named test, and starts that test's output
+	if nameOffset := testMarkerNameOffset(logs, offset); nameOffset >= 0 {
+		s.currentTest = s.matchesTest(logs, nameOffset)
+		return s.currentTest, s.currentTest != nil
+	}
+	if hasPrefix(logs, offset, testPauseMarker) {
+		s.currentTest = nil
+		testName := s.matchesTest(logs, offset+len(testPauseMarker))
+		return testName, testName != nil
+	}
+
+	// extend the "selection" to lines that don't have the prefix if we haven't moved to a new test yet
+	// Go tests must start with "Test", or the given test prefix, so we can use this as a filter to know when we moved to a new test
+	if s.currentTest != nil {
+		testPrefix := s.testPrefix
+		if testPrefix == nil {
+			testPrefix = []byte(DefaultTestPrefix)
+		}
+		if hasPrefix(logs, offset, testPrefix) {
+			s.currentTest = nil
+		} else {
+			return s.currentTest, true
+		}
+	}
+	return nil, false
+}
+
+// Returns a transform which keeps log lines up to and including the first test block which contains a failure, then stops reading.
+// A test block starts at a line which begins with testPrefix, e.g. DefaultTestPrefix, or "=== " and runs until the next such line.
+// Kept timestamps must parse using the given layout, or RFC 3339 if it is empty.
+func TruncateAfterFirstFailureTransform(testPrefix string, layout string) Transform {
+	errFirstFailureDone := errors.New("first failure done")
+	return func(r io.Reader, w io.Writer) error {
+		blockHasFailure := false
+		err := forEachLine(r, func(line []byte) error {
+			startOfMessageIdx := startOfMessage(line, layout)
+			startsBlock := hasPrefix(line, startOfMessageIdx, []byte(testPrefix)) || hasPrefix(line, startOfMessageIdx, []byte("=== "))
+			if startsBlock && blockHasFailure {
+				return errFirstFailureDone
+			}
+			if hasPrefix(line, startOfMessageIdx, testFailurePrefix) || bytes.Contains(line, testFailResult) {
+				blockHasFailure = true
+			}
+			_, err := w.Write(line)
+			return err
+		})
+		if err == errFirstFailureDone {
+			return nil
+		}
+		return err
+	}
+}
+
+var (
+	terraformCommand       = []byte("Running command terraform with args [")
+	terraformApplyCommands = [][]byte{[]byte("terraform apply"), []byte("Running command terraform with args [apply")}
+	terraformApplyComplete = []byte("Apply complete!")
+)
+
+// Parts of the benign progress lines Terraform logs for each resource, e.g. "aws_instance.foo: Still creating... [10s elapsed]".
+var terraformProgressMarkers = [][]byte{
+	[]byte(": Creating..."),
+	[]byte(": Still creating..."),
+	[]byte(": Creation complete"),
+	[]byte(": Reading..."),
+	[]byte(": Read complete"),
+	[]byte(": Refreshing state..."),
+}
+
+// Returns a transform which drops Terraform progress lines, keeping everything else such as errors and plans.
+func DropTerraformProgressTransform() Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return forEachLine(r, func(line []byte) error {
+			if matchingContains(line, terraformProgressMarkers) {
+				return nil
+			}
+			_, err := w.Write(line)
+			return err
+		})
+	}
+}
+
+// Returns a transform which includes only the lines of terraform apply sections.
+// A section starts at a terraform apply invocation, includes its plan (e.g. "Plan: 1 to add"), and ends at "Apply complete!"
+// or just before the next terraform invocation, whichever comes first.
+func ExtractApplySectionsTransform() Transform {
+	return func(r io.Reader, w io.Writer) error {
+		inSection := false
+		return forEachLine(r, func(line []byte) error {
+			if matchingContains(line, terraformApplyCommands) {
+				inSection = true
+			} else if bytes.Contains(line, terraformCommand) {
+				inSection = false
+			}
+			if !inSection {
+				return nil
+			}
+			if bytes.Contains(line, terraformApplyComplete) {
+				inSection = false
+			}
+			_, err := w.Write(line)
+			return err
+		})
+	}
+}
+
+// Match the lines which test_structure.RunTestStage logs at the start of each stage, whether it is executed or skipped.
+// The first submatch of each is the name of the stage.
+var StageMarkerPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`The '\S+' environment variable is not set, so executing stage '([^']+)'`),
+	regexp.MustCompile(`The '\S+' environment variable is set, so skipping stage '([^']+)'`),
+}
+
+// Returns the name of the stage started by the given line, or nil if the line is not a stage marker.
+func stageMarkerName(line []byte) []byte {
+	for _, pattern := range StageMarkerPatterns {
+		if match := pattern.FindSubmatch(line); match != nil {
+			return match[1]
+		}
+	}
+	return nil
+}
+
+// Returns a transform which includes only the lines of the given test_structure stage, e.g. deploy.
+// A stage starts at its marker and ends just before the next stage marker.
+func ExtractStageTransform(stage string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		inStage := false
+		return forEachLine(r, func(line []byte) error {
+			if name := stageMarkerName(line); name != nil {
+				inStage = string(name) == stage
+			}
+			if !inStage {
+				return nil
+			}
+			_, err := w.Write(line)
+			return err
+		})
+	}
+}
+
+// Returns a transform which includes only the lines from the first line containing after until the first line after it
+// containing before, then stops reading. An empty after starts at the first line, and an empty before runs until the end of the logs.
+// The anchor lines themselves are included if includeAnchors.
+func AnchorLinesTransform(after string, before string, includeAnchors bool) Transform {
+	errAnchorDone := errors.New("anchor done")
+	return func(r io.Reader, w io.Writer) error {
+		inRegion := len(after) == 0
+		err := forEachLine(r, func(line []byte) error {
+			// the raw line number is not part of the line, so an anchor never matches it
+			content, _ := cutRawLine(line)
+			if !inRegion {
+				if !bytes.Contains(content, []byte(after)) {
+					return nil
+				}
+				inRegion = true
+				if !includeAnchors {
+					return nil
+				}
+			} else if len(before) > 0 && bytes.Contains(content, []byte(before)) {
+				if includeAnchors {
+					if _, err := w.Write(line); err != nil {
+						return err
+					}
+				}
+				return errAnchorDone
+			}
+			_, err := w.Write(line)
+			return err
+		})
+		if err == errAnchorDone {
+			return nil
+		}
+		return err
+	}
+}
+
+// Returns whether the given string contains any of the given substrings.
+func matchingContains(str []byte, substrs [][]byte) bool {
+	for _, substr := range substrs {
+		if bytes.Contains(str, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	terraformDiagnosticStart = []byte("╷")
+	terraformDiagnosticEnd   = []byte("╵")
+	terraformError           = []byte("Error:")
+)
+
+// Returns a transform which includes only Terraform error diagnostics: boxed diagnostic blocks which contain an error, and standalone error lines
+// along with the indented detail lines which follow them. Up to contextLines other lines before and after each diagnostic are also included.
+// Each included line is prefixed by the name of the test which logged it, if it is not already. The names of tests start with testPrefix,
+// e.g. DefaultTestPrefix, and kept timestamps must parse using the given layout, or RFC 3339 if it is empty.
+func ExtractTerraformErrorsTransform(contextLines int, testPrefix string, layout string) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		output := &contextPrinter{w: w, contextLines: contextLines}
+		owner := []byte{}
+		block := [][]byte{}
+		inBlock := false
+		blockHasError := false
+		inErrorDetail := false
+
+		addOwner := func(line []byte) []byte {
+			startOfMessageIdx := startOfMessage(line, layout)
+			if len(owner) == 0 || hasPrefix(line, startOfMessageIdx, owner) {
+				return line
+			}
+			dst := append([]byte{}, line[:startOfMessageIdx]...)
+			dst = append(dst, owner...)
+			dst = append(dst, ' ')
+			return append(dst, line[startOfMessageIdx:]...)
+		}
+		writeBlock := func() error {
+			for _, blockLine := range block {
+				if err := output.write(blockLine, blockHasError); err != nil {
+					return err
+				}
+			}
+			block = block[:0]
+			return nil
+		}
+
+		err := forEachLine(r, func(line []byte) error {
+			startOfMessageIdx := startOfMessage(line, layout)
+			detail := line[startOfMessageIdx:]
+			if hasPrefix(line, startOfMessageIdx, []byte(testPrefix)) {
+				if testName := leadingToken(line, startOfMessageIdx); !bytes.Equal(testName, owner) {
+					// another test's output ends the detail of this test's error
+					owner = testName
+					inErrorDetail = false
+				}
+				detail = bytes.TrimPrefix(detail[len(owner):], []byte(" "))
+			}
+			isDetail := inErrorDetail && (hasPrefix(detail, 0, []byte(" ")) || hasPrefix(detail, 0, []byte("\t")))
+			inErrorDetail = false
+
+			switch {
+			case isDetail:
+				inErrorDetail = true
+				return output.write(addOwner(line), true)
+			case inBlock:
+				block = append(block, addOwner(line))
+				blockHasError = blockHasError || bytes.Contains(line, terraformError)
+				if bytes.Contains(line, terraformDiagnosticEnd) {
+					inBlock = false
+					// whether the block is included is only known at its end
+					return writeBlock()
+				}
+				return nil
+			case bytes.Contains(line, terraformDiagnosticStart):
+				block = append(block, addOwner(line))
+				inBlock = true
+				blockHasError = false
+				return nil
+			case bytes.Contains(line, terraformError):
+				inErrorDetail = true
+				return output.write(addOwner(line), true)
+			default:
+				return output.write(addOwner(line), false)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		// a block cut off by the end of the logs is still worth showing
+		return writeBlock()
+	}
+}
+
+// Returns the token starting at the given offset and ending before the next space or newline.
+func leadingToken(str []byte, offset int) []byte {
+	for i := offset; i < len(str); i++ {
+		if str[i] == ' ' || str[i] == '\n' {
+			return str[offset:i]
+		}
+	}
+	return str[offset:]
+}
+
+// Returns the given number of space-separated tokens starting at the given offset, ending before the space which follows the last of them or before the next newline.
+func leadingTokens(str []byte, offset int, count int) []byte {
+	end := offset + len(leadingToken(str, offset))
+	for i := 1; i < count && hasPrefix(str, end, []byte(" ")); i++ {
+		end += 1 + len(leadingToken(str, end+1))
+	}
+	return str[offset:end]
+}
+
+// Returns whether the given string, starting at the given offset, equals the given prefix for the length of the given prefix.
+func hasPrefix(str []byte, offset int, prefix []byte) bool {
+	for i := 0; i < len(prefix); i++ {
+		if offset+i >= len(str) || str[offset+i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var testFailurePrefix = []byte("=== NAME  ")
+
+// The markers which go test logs before the name of a test whose output follows, e.g. "=== RUN   TestFoo" when the test starts.
+// Go 1.20 and later log "=== NAME" before more output of a test which failed, while earlier versions log "=== CONT".
+var testOutputMarkers = [][]byte{
+	[]byte("=== RUN   "),
+	[]byte("=== CONT  "),
+	testFailurePrefix,
+}
+
+// The markers which go test logs before the name of a test with its result, e.g. "--- FAIL: TestFoo (1.00s)".
+var testResultMarkers = [][]byte{
+	[]byte("--- FAIL: "),
+	[]byte("--- PASS: "),
+	[]byte("--- SKIP: "),
+}
+
+// Returns the offset of the test name which follows a test marker at the given offset, e.g. "=== RUN   ", or -1 if there is none.
+// A result marker may be indented, as go test indents the results of subtests.
+func testMarkerNameOffset(str []byte, offset int) int {
+	for _, marker := range testOutputMarkers {
+		if hasPrefix(str, offset, marker) {
+			return offset + len(marker)
+		}
+	}
+	resultOffset := offset
+	for resultOffset < len(str) && (str[resultOffset] == ' ' || str[resultOffset] == '\t') {
+		resultOffset++
+	}
+	for _, marker := range testResultMarkers {
+		if hasPrefix(str, resultOffset, marker) {
+			return resultOffset + len(marker)
+		}
+	}
+	return -1
+}
@@ -0,0 +1,235 @@
+package logviewer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// A streaming stage of the log processing pipeline.
+// Reads logs from r and writes the transformed logs to w. A transform may return before reading all of r.
+type Transform func(r io.Reader, w io.Writer) error
+
+// Streams the logs from src through each of the given transforms in order, writing the result to dst.
+// Returns the first error returned by a transform.
+func RunPipeline(src io.Reader, dst io.Writer, transforms ...Transform) error {
+	if len(transforms) == 0 {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+
+	errs := make([]error, len(transforms))
+	done := make(chan struct{}, len(transforms))
+	input := src
+	for i, transform := range transforms {
+		output := dst
+		var nextInput *io.PipeReader
+		var pipeOutput *io.PipeWriter
+		if i < len(transforms)-1 {
+			nextInput, pipeOutput = io.Pipe()
+			output = pipeOutput
+		}
+
+		go func(i int, transform Transform, input io.Reader, output io.Writer) {
+			err := transform(input, output)
+			errs[i] = err
+			// the next transform reads EOF (or the error), and the previous transform's writes fail so it stops early
+			if pipeOutput != nil {
+				pipeOutput.CloseWithError(err)
+			}
+			if pipeInput, ok := input.(*io.PipeReader); ok {
+				pipeInput.CloseWithError(err)
+			}
+			done <- struct{}{}
+		}(i, transform, input, output)
+
+		input = nextInput
+	}
+
+	for range transforms {
+		<-done
+	}
+
+	for _, err := range errs {
+		// a transform which stopped early closes its input, which is not an error for the transform writing to it
+		if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the given transform with its output also counted by counter, e.g. to report how many lines each stage keeps.
+func CountLinesTransform(transform Transform, counter *LineCounter) Transform {
+	return func(r io.Reader, w io.Writer) error {
+		return transform(r, io.MultiWriter(w, counter))
+	}
+}
+
+// Returns the result of running the given logs through the given transform.
+func transformBytes(logs []byte, transform Transform) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := transform(bytes.NewReader(logs), buf)
+	return buf.Bytes(), err
+}
+
+// Calls fn with each line read from r, including its trailing newline if it has one.
+// CRLF line endings are normalized to LF so that fn never sees a stray \r at the end of a line.
+// Stops at the first error returned by fn.
+func forEachLine(r io.Reader, fn func(line []byte) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			line = append(line[:len(line)-2], '\n')
+		} else if err == io.EOF {
+			line = bytes.TrimSuffix(line, []byte("\r"))
+		}
+		if len(line) > 0 {
+			if fnErr := fn(line); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// An io.Writer which counts the bytes and lines written to it.
+type LineCounter struct {
+	Bytes    int
+	newlines int
+	last     byte
+}
+
+func (c *LineCounter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		c.Bytes += len(p)
+		c.newlines += bytes.Count(p, []byte("\n"))
+		c.last = p[len(p)-1]
+	}
+	return len(p), nil
+}
+
+// Returns the number of lines written, counting a final line without a trailing newline.
+func (c *LineCounter) Lines() int {
+	if c.Bytes > 0 && c.last != '\n' {
+		return c.newlines + 1
+	}
+	return c.newlines
+}
+
+// Writes lines which are included along with up to contextLines excluded lines before and after each included line, like grep -C.
+// Non-adjacent groups of lines are separated by a "--" line.
+type contextPrinter struct {
+	w            io.Writer
+	contextLines int
+	// excluded lines which have not been written, up to contextLines of the most recent
+	before [][]byte
+	// the number of excluded lines which have not been written since the last line which was written
+	skipped        int
+	afterRemaining int
+	wroteAny       bool
+}
+
+// Writes the given line if it is included or if it is within the context of an included line.
+// Every line must be given in order for the context to be correct.
+func (p *contextPrinter) write(line []byte, included bool) error {
+	if !included {
+		if p.afterRemaining > 0 {
+			p.afterRemaining--
+			return p.writeLine(line)
+		}
+		if p.contextLines > 0 {
+			p.before = append(p.before, line)
+			if len(p.before) > p.contextLines {
+				p.before = p.before[1:]
+			}
+		}
+		p.skipped++
+		return nil
+	}
+
+	// the before context is only as far back as the lines which were skipped, so it never repeats a line
+	p.skipped -= len(p.before)
+	for _, beforeLine := range p.before {
+		if err := p.writeLine(beforeLine); err != nil {
+			return err
+		}
+	}
+	p.before = p.before[:0]
+	p.afterRemaining = p.contextLines
+	return p.writeLine(line)
+}
+
+func (p *contextPrinter) writeLine(line []byte) error {
+	if p.contextLines > 0 && p.wroteAny && p.skipped > 0 {
+		if _, err := io.WriteString(p.w, "--\n"); err != nil {
+			return err
+		}
+	}
+	p.skipped = 0
+	p.wroteAny = true
+	_, err := p.w.Write(line)
+	return err
+}
+
+// Separates a line from the raw line number appended to it by NumberRawLinesTransform.
+const rawLineSeparator = '\x1f'
+
+// Returns a transform which appends to each line, before its newline, its 1-based line number in the raw logs, e.g. to deep-link
+// to the line in the log view of GitHub. The logs of several jobs are numbered from 1 after each job's separator line, like in the
+// log view of each job, and the separator lines are not numbered. The number is carried through RedactTransform, AnchorLinesTransform, FilterTimeRangeTransform,
+// and FilterLinesTransform, which ignore it, and is output by FormatJSONTransform as raw_line. Other transforms do not expect it.
+func NumberRawLinesTransform() Transform {
+	return func(r io.Reader, w io.Writer) error {
+		number := 0
+		return forEachLine(r, func(line []byte) error {
+			if isJobSeparator(line) {
+				number = 0
+				_, err := w.Write(line)
+				return err
+			}
+			number++
+			_, err := w.Write(withRawLine(line, number))
+			return err
+		})
+	}
+}
+
+// Returns the given line without the raw line number appended by NumberRawLinesTransform, and the number, or 0 if it has none.
+func cutRawLine(line []byte) ([]byte, int) {
+	content, newline := bytes.CutSuffix(line, []byte("\n"))
+	separatorIdx := bytes.LastIndexByte(content, rawLineSeparator)
+	if separatorIdx < 0 {
+		return line, 0
+	}
+	number, err := strconv.Atoi(string(content[separatorIdx+1:]))
+	if err != nil {
+		return line, 0
+	}
+	untagged := content[:separatorIdx:separatorIdx]
+	if newline {
+		untagged = append(untagged, '\n')
+	}
+	return untagged, number
+}
+
+// Returns the given line with the given raw line number appended like NumberRawLinesTransform, or unchanged if the number is 0.
+func withRawLine(line []byte, number int) []byte {
+	if number == 0 {
+		return line
+	}
+	content, newline := bytes.CutSuffix(line, []byte("\n"))
+	tagged := append(append([]byte{}, content...), rawLineSeparator)
+	tagged = strconv.AppendInt(tagged, int64(number), 10)
+	if newline {
+		tagged = append(tagged, '\n')
+	}
+	return tagged
+}
@@ -0,0 +1,136 @@
+package logviewer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPipeline(t *testing.T) {
+	t.Parallel()
+	logs := "2023-05-02T19:31:15.2539162Z TestA 1\n2023-05-02T19:31:15.2539162Z TestB 1\n2023-05-02T19:31:15.2539162Z TestA 2"
+	matchesTest := TestNamesMatcher([][]byte{[]byte("TestA")})
+	output := &bytes.Buffer{}
+	err := RunPipeline(strings.NewReader(logs), output, RemoveTimestampPrefixTransform(""), FilterLogsTransform(matchesTest), RemoveTestNamePrefixTransform(matchesTest, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2", output.String())
+}
+
+func TestRunPipelineWithoutTransforms(t *testing.T) {
+	t.Parallel()
+	output := &bytes.Buffer{}
+	assert.NoError(t, RunPipeline(strings.NewReader("TestA 1\n"), output))
+	assert.Equal(t, "TestA 1\n", output.String())
+}
+
+// a transform which stops early should stop the transforms before it from reading the rest of the logs
+func TestRunPipelineStopsReadingEarly(t *testing.T) {
+	t.Parallel()
+	logs := "TestA 1\n=== NAME  TestA\n--- FAIL: TestA (1.00s)\n" + strings.Repeat("TestB 1\n", 1_000_000)
+	counter := &LineCounter{}
+	output := &bytes.Buffer{}
+	err := RunPipeline(io.TeeReader(strings.NewReader(logs), counter), output, RemoveTestNamePrefixTransform(TestNamesMatcher(nil), ""), TruncateAfterFirstFailureTransform(DefaultTestPrefix, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "TestA 1\n=== NAME  TestA\n--- FAIL: TestA (1.00s)\n", output.String())
+	assert.Less(t, counter.Bytes, len(logs))
+}
+
+func TestRunPipelineHeadStopsReadingEarly(t *testing.T) {
+	t.Parallel()
+	logs := strings.Repeat("TestA 1\n", 1_000_000)
+	counter := &LineCounter{}
+	output := &bytes.Buffer{}
+	err := RunPipeline(io.TeeReader(strings.NewReader(logs), counter), output, RemoveTimestampPrefixTransform(""), HeadLinesTransform(2, false))
+	assert.NoError(t, err)
+	assert.Equal(t, "TestA 1\nTestA 1\n", output.String())
+	assert.Less(t, counter.Bytes, len(logs))
+}
+
+// a failure after the head is still seen by the transforms before it
+func TestRunPipelineHeadReadsAll(t *testing.T) {
+	t.Parallel()
+	logs := strings.Repeat("TestA 1\n", 10_000) + "--- FAIL: TestA (1.00s)\n"
+	failed := false
+	output := &bytes.Buffer{}
+	err := RunPipeline(strings.NewReader(logs), output, DetectFailureTransform(&failed), HeadLinesTransform(1, true))
+	assert.NoError(t, err)
+	assert.Equal(t, "TestA 1\n", output.String())
+	assert.True(t, failed)
+}
+
+func TestRunPipelineReturnsTransformError(t *testing.T) {
+	t.Parallel()
+	errBroken := errors.New("broken")
+	broken := func(r io.Reader, w io.Writer) error {
+		return errBroken
+	}
+	err := RunPipeline(strings.NewReader("TestA 1\n"), io.Discard, RemoveTimestampPrefixTransform(""), broken)
+	assert.ErrorIs(t, err, errBroken)
+}
+
+func TestCountLinesTransform(t *testing.T) {
+	t.Parallel()
+	matchesTest := TestNamesMatcher([][]byte{[]byte("TestA")})
+	filtered := &LineCounter{}
+	output := &bytes.Buffer{}
+	err := RunPipeline(strings.NewReader("TestA 1\nTestB 1\nTestA 2\n"), output, CountLinesTransform(FilterLogsTransform(matchesTest), filtered), RemoveTestNamePrefixTransform(matchesTest, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2\n", output.String())
+	assert.Equal(t, 2, filtered.Lines())
+}
+
+func TestNumberRawLines(t *testing.T) {
+	t.Parallel()
+	logs := jobNameSeparator("test (1)") + "TestA 1\nTestA 2\n" + jobNameSeparator("test (2)") + "TestB 1\n"
+	actual, err := transformBytes([]byte(logs), NumberRawLinesTransform())
+	assert.NoError(t, err)
+	assert.Equal(t, "===== job: test (1) =====\nTestA 1\x1f1\nTestA 2\x1f2\n===== job: test (2) =====\nTestB 1\x1f1\n", string(actual))
+}
+
+func TestForEachLine(t *testing.T) {
+	t.Parallel()
+	lines := []string{}
+	err := forEachLine(strings.NewReader("a\n\nb"), func(line []byte) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a\n", "\n", "b"}, lines)
+}
+
+func TestForEachLineCRLF(t *testing.T) {
+	t.Parallel()
+	lines := []string{}
+	err := forEachLine(strings.NewReader("a\r\n\r\nb\rc\r"), func(line []byte) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a\n", "\n", "b\rc"}, lines)
+}
+
+func TestLineCounter(t *testing.T) {
+	t.Parallel()
+	counter := &LineCounter{}
+	assert.Equal(t, 0, counter.Lines())
+	counter.Write([]byte("a\nb"))
+	assert.Equal(t, 2, counter.Lines())
+	counter.Write([]byte("\n"))
+	assert.Equal(t, 2, counter.Lines())
+	assert.Equal(t, 4, counter.Bytes)
+}
+
+func TestContextPrinter(t *testing.T) {
+	t.Parallel()
+	output := &bytes.Buffer{}
+	printer := &contextPrinter{w: output, contextLines: 2}
+	for i, included := range []bool{false, false, false, true, false, false, false, false, false, true, false} {
+		assert.NoError(t, printer.write([]byte(fmt.Sprintf("%d\n", i)), included))
+	}
+	assert.Equal(t, "1\n2\n3\n4\n5\n--\n7\n8\n9\n10\n", output.String())
+}
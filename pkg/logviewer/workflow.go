@@ -0,0 +1,186 @@
+package logviewer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The parts of a GitHub Actions workflow file used to detect which workflow and job run the tests.
+type workflowFile struct {
+	Jobs map[string]workflowJob `yaml:"jobs"`
+}
+
+type workflowJob struct {
+	Name     string           `yaml:"name"`
+	Steps    []workflowStep   `yaml:"steps"`
+	Strategy workflowStrategy `yaml:"strategy"`
+}
+
+type workflowStrategy struct {
+	Matrix yaml.Node `yaml:"matrix"`
+}
+
+type workflowStep struct {
+	Run string `yaml:"run"`
+}
+
+// Returns whether any step of the job runs go test.
+func (j workflowJob) runsGoTest() bool {
+	for _, step := range j.Steps {
+		if strings.Contains(step.Run, "go test") {
+			return true
+		}
+	}
+	return false
+}
+
+var matrixExpressionRegex = regexp.MustCompile(`\$\{\{\s*matrix\.([\w\-]+)\s*\}\}`)
+
+// Returns the base filename of the given workflow, which may be given as a path such as .github/workflows/test.yml,
+// and whether it has the extension of a workflow file, .yml or .yaml.
+func NormalizeWorkflowFilename(workflow string) (string, bool) {
+	filename := filepath.Base(filepath.FromSlash(workflow))
+	extension := filepath.Ext(filename)
+	return filename, extension == ".yml" || extension == ".yaml"
+}
+
+// Returns the names GitHub may display for the job with the given ID, one for each combination of its matrix.
+func (j workflowJob) displayNames(id string) []string {
+	combinations := matrixCombinations(j.Strategy.Matrix)
+	if len(combinations) == 0 {
+		if len(j.Name) > 0 {
+			return []string{j.Name}
+		}
+		return []string{id}
+	}
+
+	names := []string{}
+	for _, combination := range combinations {
+		if len(j.Name) > 0 {
+			names = append(names, matrixExpressionRegex.ReplaceAllStringFunc(j.Name, func(expression string) string {
+				key := matrixExpressionRegex.FindStringSubmatch(expression)[1]
+				for _, value := range combination {
+					if value.key == key {
+						return value.value
+					}
+				}
+				return expression
+			}))
+		} else {
+			values := []string{}
+			for _, value := range combination {
+				values = append(values, value.value)
+			}
+			names = append(names, fmt.Sprintf("%s (%s)", id, strings.Join(values, ", ")))
+		}
+	}
+	return names
+}
+
+type matrixValue struct {
+	key   string
+	value string
+}
+
+// Returns every combination of the values of the given matrix, in the order GitHub uses for job names.
+// Only lists of scalar values are expanded; include, exclude, and expressions are ignored.
+func matrixCombinations(matrix yaml.Node) [][]matrixValue {
+	if matrix.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	combinations := [][]matrixValue{{}}
+	for i := 0; i+1 < len(matrix.Content); i += 2 {
+		key := matrix.Content[i].Value
+		values := matrix.Content[i+1]
+		if key == "include" || key == "exclude" || values.Kind != yaml.SequenceNode {
+			continue
+		}
+
+		newCombinations := [][]matrixValue{}
+		for _, combination := range combinations {
+			for _, value := range values.Content {
+				newCombination := append(append([]matrixValue{}, combination...), matrixValue{key: key, value: value.Value})
+				newCombinations = append(newCombinations, newCombination)
+			}
+		}
+		combinations = newCombinations
+	}
+
+	if len(combinations) == 1 && len(combinations[0]) == 0 {
+		return nil
+	}
+	return combinations
+}
+
+// Returns the name of the only job in the workflow at the given path which runs go test.
+func FindTestJob(workflowPath string) (string, error) {
+	workflow, err := readWorkflowFile(workflowPath)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []string{}
+	for id, job := range workflow.Jobs {
+		if job.runsGoTest() {
+			candidates = append(candidates, job.displayNames(id)...)
+		}
+	}
+	sort.Strings(candidates)
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no job in %s runs go test", workflowPath)
+	} else if len(candidates) > 1 {
+		return "", fmt.Errorf("more than one job runs go test: %s", strings.Join(candidates, ", "))
+	}
+	return candidates[0], nil
+}
+
+// Returns the parsed workflow file at the given path.
+func readWorkflowFile(path string) (workflowFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return workflowFile{}, err
+	}
+	workflow := workflowFile{}
+	if err := yaml.Unmarshal(content, &workflow); err != nil {
+		return workflowFile{}, fmt.Errorf("failed to parse workflow %s: %w", path, err)
+	}
+	return workflow, nil
+}
+
+// Returns the filename of the only workflow in the given directory which has a job that runs go test.
+func FindTestWorkflow(workflowsDir string) (string, error) {
+	candidates := []string{}
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		paths, err := filepath.Glob(filepath.Join(workflowsDir, pattern))
+		if err != nil {
+			return "", err
+		}
+		for _, path := range paths {
+			workflow, err := readWorkflowFile(path)
+			if err != nil {
+				return "", err
+			}
+			for _, job := range workflow.Jobs {
+				if job.runsGoTest() {
+					candidates = append(candidates, filepath.Base(path))
+					break
+				}
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no workflow in %s runs go test", workflowsDir)
+	} else if len(candidates) > 1 {
+		return "", fmt.Errorf("more than one workflow runs go test: %s", strings.Join(candidates, ", "))
+	}
+	return candidates[0], nil
+}
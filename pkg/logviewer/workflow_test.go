@@ -0,0 +1,125 @@
+package logviewer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes the given workflow files into a temporary .github/workflows directory and returns its path.
+func writeWorkflows(t *testing.T, workflows map[string]string) string {
+	dir := filepath.Join(t.TempDir(), ".github", "workflows")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	for name, content := range workflows {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+const testWorkflow = `
+name: Test
+on: push
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v3
+      - run: go test ./...
+`
+
+const lintWorkflow = `
+name: Lint
+on: push
+jobs:
+  lint:
+    runs-on: ubuntu-latest
+    steps:
+      - run: go vet ./...
+`
+
+func TestNormalizeWorkflowFilename(t *testing.T) {
+	t.Parallel()
+	filename, ok := NormalizeWorkflowFilename(".github/workflows/test.yml")
+	assert.Equal(t, "test.yml", filename)
+	assert.True(t, ok)
+	filename, ok = NormalizeWorkflowFilename("test.yaml")
+	assert.Equal(t, "test.yaml", filename)
+	assert.True(t, ok)
+	filename, ok = NormalizeWorkflowFilename("Test Workflow")
+	assert.Equal(t, "Test Workflow", filename)
+	assert.False(t, ok)
+}
+
+func TestFindTestWorkflow(t *testing.T) {
+	t.Parallel()
+	dir := writeWorkflows(t, map[string]string{"test.yml": testWorkflow, "lint.yaml": lintWorkflow})
+	workflow, err := FindTestWorkflow(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "test.yml", workflow)
+}
+
+func TestFindTestWorkflowAmbiguous(t *testing.T) {
+	t.Parallel()
+	dir := writeWorkflows(t, map[string]string{"test.yml": testWorkflow, "nightly.yaml": testWorkflow})
+	_, err := FindTestWorkflow(dir)
+	assert.EqualError(t, err, "more than one workflow runs go test: test.yml, nightly.yaml")
+}
+
+func TestFindTestWorkflowNone(t *testing.T) {
+	t.Parallel()
+	dir := writeWorkflows(t, map[string]string{"lint.yaml": lintWorkflow})
+	_, err := FindTestWorkflow(dir)
+	assert.ErrorContains(t, err, "runs go test")
+}
+
+func TestFindTestJob(t *testing.T) {
+	t.Parallel()
+	dir := writeWorkflows(t, map[string]string{"test.yml": testWorkflow + `
+  lint:
+    runs-on: ubuntu-latest
+    steps:
+      - run: go vet ./...
+`})
+	job, err := FindTestJob(filepath.Join(dir, "test.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test", job)
+}
+
+func TestFindTestJobNamed(t *testing.T) {
+	t.Parallel()
+	dir := writeWorkflows(t, map[string]string{"test.yml": `
+jobs:
+  test:
+    name: Terratest
+    steps:
+      - run: go test -v -timeout 60m ./...
+`})
+	job, err := FindTestJob(filepath.Join(dir, "test.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Terratest", job)
+}
+
+func TestFindTestJobMatrix(t *testing.T) {
+	t.Parallel()
+	dir := writeWorkflows(t, map[string]string{"test.yml": `
+jobs:
+  test:
+    strategy:
+      matrix:
+        region: [us-east-1, us-west-2]
+        go: ["1.20"]
+    steps:
+      - run: go test ./...
+  named:
+    name: e2e ${{ matrix.region }}
+    strategy:
+      matrix:
+        region: [eu-west-1]
+    steps:
+      - run: go test ./e2e/...
+`})
+	_, err := FindTestJob(filepath.Join(dir, "test.yml"))
+	assert.EqualError(t, err, "more than one job runs go test: e2e eu-west-1, test (us-east-1, 1.20), test (us-west-2, 1.20)")
+}